@@ -0,0 +1,211 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package clientip resolves the IP address of the client which sent an HTTP request,
+// honoring the forwarding headers set by trusted proxies, and makes it available through
+// the request's context.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Forwarding headers supported, see WithHeader.
+const (
+	Forwarded     = "Forwarded"
+	XForwardedFor = "X-Forwarded-For"
+	XRealIP       = "X-Real-Ip"
+)
+
+// PrivateNetworks are the loopback and private network ranges, for deployments whose
+// proxies run in a private network. See WithTrustedProxies.
+var PrivateNetworks = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+}
+
+// Resolver resolves the IP addresses of clients.
+type Resolver struct {
+	trusted []netip.Prefix
+	header  string
+}
+
+// Option implements http://commandcenter.blogspot.com/2014/01/self-referential-functions-and-design.html
+type Option func(*Resolver)
+
+// WithTrustedProxies configures the proxies whose forwarding headers are honored, as IP
+// addresses or CIDR ranges. By default no proxy is trusted and the client IP is always
+// the remote address of the connection. It panics if any of them is invalid.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(rs *Resolver) {
+		for _, p := range proxies {
+			prefix, err := parsePrefix(p)
+			if err != nil {
+				panic(fmt.Sprintf("clientip: invalid trusted proxy %q: %v", p, err))
+			}
+			rs.trusted = append(rs.trusted, prefix)
+		}
+	}
+}
+
+// WithHeader configures the forwarding header honored: Forwarded, X-Forwarded-For or
+// X-Real-IP. Defaults to X-Forwarded-For. It has to be the header your proxies set, the
+// others are ignored: clients can send any of them, and most proxies pass through the
+// headers they do not maintain, so honoring several would let clients spoof their IP.
+func WithHeader(name string) Option {
+	return func(rs *Resolver) {
+		rs.header = http.CanonicalHeaderKey(name)
+	}
+}
+
+// NewResolver returns a new Resolver configured with the given options.
+func NewResolver(opts ...Option) *Resolver {
+	// Sets default options
+	rs := &Resolver{
+		header: XForwardedFor,
+	}
+
+	for _, opt := range opts {
+		opt(rs)
+	}
+	return rs
+}
+
+// ClientIP returns the IP address of the client which sent the request. If the request
+// comes from a trusted proxy, the chain of addresses in the forwarding header is walked
+// from right to left, that is, from the closest hop to the furthest, and the first address
+// not trusted is returned. Entries that cannot be parsed, such as obfuscated identifiers,
+// stop the walk at the last trusted hop. It returns an invalid address if the remote
+// address of the connection cannot be parsed either.
+func (rs *Resolver) ClientIP(r *http.Request) netip.Addr {
+	remote := parseAddr(r.RemoteAddr)
+	if !rs.trusts(remote) {
+		return remote
+	}
+
+	chain := parseChain(rs.header, r.Header.Values(rs.header))
+	ip := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !chain[i].IsValid() {
+			break
+		}
+		ip = chain[i]
+		if !rs.trusts(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// trusts returns whether the given address belongs to a trusted proxy.
+func (rs *Resolver) trusts(ip netip.Addr) bool {
+	if !ip.IsValid() {
+		return false
+	}
+	for _, p := range rs.trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler resolves the IP address of the client for every request and stores it in the
+// request's context, see FromContext.
+func Handler(h http.Handler, opts ...Option) http.Handler {
+	rs := NewResolver(opts...)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := rs.ClientIP(r)
+		if !ip.IsValid() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(NewContext(r.Context(), ip)))
+	})
+}
+
+// parseChain returns the addresses listed in the values of the given forwarding header,
+// from the furthest hop to the closest one. Entries that cannot be parsed are returned as
+// invalid addresses.
+func parseChain(name string, values []string) []netip.Addr {
+	var chain []netip.Addr
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			if name == Forwarded {
+				elem = forwardedFor(elem)
+			}
+			chain = append(chain, parseAddr(strings.TrimSpace(elem)))
+		}
+	}
+	return chain
+}
+
+// forwardedFor returns the value of the "for" parameter of an element of the Forwarded
+// header, as described in RFC 7239 section 4.
+func forwardedFor(elem string) string {
+	for _, pair := range strings.Split(elem, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && strings.EqualFold(k, "for") {
+			return strings.Trim(v, `"`)
+		}
+	}
+	return ""
+}
+
+// parseAddr parses an IP address, optionally enclosed in brackets and followed by a port,
+// as in RFC 7239 node names. It returns an invalid address otherwise.
+func parseAddr(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ip.Unmap().WithZone("")
+}
+
+// parsePrefix parses a CIDR range or a single IP address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return p.Masked(), nil
+	}
+
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	ip = ip.Unmap()
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// clientIPKey is the key used to store the client IP in the request's context.
+type clientIPKey struct{}
+
+// NewContext returns a new context carrying the given client IP.
+func NewContext(ctx context.Context, ip netip.Addr) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// FromContext extracts the client IP from the given context.
+func FromContext(ctx context.Context) (ip netip.Addr, ok bool) {
+	ip, ok = ctx.Value(clientIPKey{}).(netip.Addr)
+	return
+}
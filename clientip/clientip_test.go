@@ -0,0 +1,80 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []Option{WithTrustedProxies("10.0.0.0/8", "2001:db8:cafe::/48", "192.0.2.1")}
+
+	tests := []struct {
+		name     string
+		remote   string
+		header   http.Header
+		opts     []Option
+		expected string
+	}{
+		{"no headers", "203.0.113.7:1234", nil, trusted, "203.0.113.7"},
+		{"untrusted remote", "203.0.113.7:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, trusted, "203.0.113.7"},
+		{"no trusted proxies", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, nil, "10.0.0.1"},
+		{"x-forwarded-for", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, trusted, "198.51.100.1"},
+		{"spoofed x-forwarded-for", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.0.0.2"}}, trusted, "198.51.100.1"},
+		{"multiple header lines", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1", "10.0.0.2"}}, trusted, "198.51.100.1"},
+		{"all trusted", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, trusted, "10.0.0.3"},
+		{"invalid entry", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1, garbage, 10.0.0.2"}}, trusted, "10.0.0.2"},
+		{"x-real-ip", "192.0.2.1:1234", http.Header{"X-Real-Ip": {"198.51.100.1"}}, append([]Option{WithHeader("x-real-ip")}, trusted...), "198.51.100.1"},
+		{"forwarded", "10.0.0.1:1234", http.Header{"Forwarded": {`for=198.51.100.1;proto=https, For="[2001:db8:cafe::17]:4711"`}}, append([]Option{WithHeader(Forwarded)}, trusted...), "198.51.100.1"},
+		{"forwarded ipv6", "10.0.0.1:1234", http.Header{"Forwarded": {`for="[2001:db8::17]:4711"`}}, append([]Option{WithHeader(Forwarded)}, trusted...), "2001:db8::17"},
+		{"forwarded obfuscated", "10.0.0.1:1234", http.Header{"Forwarded": {`for=_hidden`}}, append([]Option{WithHeader(Forwarded)}, trusted...), "10.0.0.1"},
+		{"forged forwarded", "10.0.0.1:1234", http.Header{"Forwarded": {"for=1.2.3.4"}, "X-Forwarded-For": {"203.0.113.7"}}, trusted, "203.0.113.7"},
+		{"forged x-forwarded-for", "10.0.0.1:1234", http.Header{"Forwarded": {"for=203.0.113.7"}, "X-Forwarded-For": {"1.2.3.4"}},
+			append([]Option{WithHeader(Forwarded)}, trusted...), "203.0.113.7"},
+		{"other headers ignored", "10.0.0.1:1234", http.Header{"X-Real-Ip": {"1.2.3.4"}}, trusted, "10.0.0.1"},
+		{"ipv4-mapped", "[::ffff:10.0.0.1]:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, trusted, "198.51.100.1"},
+		{"private networks", "127.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, []Option{WithTrustedProxies(PrivateNetworks...)}, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+
+			assert.Equals(t, netip.MustParseAddr(tt.expected), NewResolver(tt.opts...).ClientIP(req))
+		})
+	}
+}
+
+func TestWithTrustedProxiesInvalid(t *testing.T) {
+	defer func() {
+		assert.Cond(t, recover() != nil, "invalid trusted proxies should panic")
+	}()
+	NewResolver(WithTrustedProxies("10.0.0.0/33"))
+}
+
+func TestHandler(t *testing.T) {
+	var ip netip.Addr
+	var ok bool
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, ok = FromContext(r.Context())
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(XForwardedFor, "198.51.100.1")
+	Handler(requestHandler, WithTrustedProxies("10.0.0.0/8")).ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equals(t, true, ok)
+	assert.Equals(t, "198.51.100.1", ip.String())
+}
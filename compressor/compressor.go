@@ -0,0 +1,698 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package compressor implements content negotiation and compression for HTTP
+// responses using brotli, zstd, gzip or deflate.
+package compressor
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/c4milo/handlers/internal"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	brEncoding       = "br"
+	zstdEncoding     = "zstd"
+	gzipEncoding     = "gzip"
+	deflateEncoding  = "deflate"
+	identityEncoding = "identity"
+
+	acceptEncoding  = "Accept-Encoding"
+	contentEncoding = "Content-Encoding"
+	contentLength   = "Content-Length"
+	contentType     = "Content-Type"
+	vary            = "Vary"
+	secWebSocketKey = "Sec-WebSocket-Key"
+	eventStream     = "text/event-stream"
+
+	BestCompression    = gzip.BestCompression
+	BestSpeed          = gzip.BestSpeed
+	DefaultCompression = gzip.DefaultCompression
+	NoCompression      = gzip.NoCompression
+
+	// DefaultMinSize is the default minimum size of a response body, in bytes,
+	// for it to be compressed. Smaller bodies usually fit in a single TCP packet
+	// and do not benefit from compression.
+	DefaultMinSize = 1400
+
+	// DefaultMaxBodySize is the default maximum size of a decompressed request body, in bytes.
+	DefaultMaxBodySize = 10 << 20
+)
+
+// defaultContentTypes are the media types compressed by default. Images, audio, video
+// and archive formats are left out since they are compressed already.
+var defaultContentTypes = []string{
+	"text/*",
+	"application/atom+xml",
+	"application/javascript",
+	"application/json",
+	"application/ld+json",
+	"application/manifest+json",
+	"application/rss+xml",
+	"application/vnd.ms-fontobject",
+	"application/wasm",
+	"application/x-javascript",
+	"application/xhtml+xml",
+	"application/xml",
+	"font/otf",
+	"font/ttf",
+	"image/svg+xml",
+	"image/x-icon",
+}
+
+// http://commandcenter.blogspot.com/2014/01/self-referential-functions-and-design.html
+type option func(*handler)
+
+// Internal handler
+type handler struct {
+	compressionLevel int
+	brotliLevel      int
+	encodings        []string
+	minSize          int
+	contentTypes     []string
+	skipEventStream  bool
+	maxBodySize      int64
+	excludes         []func(*http.Request) bool
+	observer         func(*http.Request, Stats)
+	pools            map[string]*sync.Pool
+}
+
+// Encodings sets the content-codings the handler is allowed to use, in order of
+// server preference. When the client assigns the same quality value to more than
+// one of them, the one listed first wins.
+// Supported values:
+// * "br"
+// * "zstd"
+// * "gzip"
+// * "deflate"
+func Encodings(encodings ...string) option {
+	return func(h *handler) {
+		h.encodings = encodings
+	}
+}
+
+// BrotliLevel allows configuring brotli compression level, from 0 to 11.
+func BrotliLevel(l int) option {
+	return func(h *handler) {
+		h.brotliLevel = l
+	}
+}
+
+// MinSize sets the minimum size of the response body, in bytes, for it to be compressed.
+// Up to this many bytes are buffered before deciding whether to compress or not.
+// Defaults to DefaultMinSize.
+func MinSize(n int) option {
+	return func(h *handler) {
+		h.minSize = n
+	}
+}
+
+// ContentTypes sets the media types allowed to be compressed, replacing the default
+// list. Wildcard subtypes such as "text/*" are supported. Calling it without any
+// arguments allows compressing all content types.
+func ContentTypes(types ...string) option {
+	return func(h *handler) {
+		h.contentTypes = make([]string, 0, len(types))
+		for _, t := range types {
+			h.contentTypes = append(h.contentTypes, strings.ToLower(strings.TrimSpace(t)))
+		}
+	}
+}
+
+// SkipEventStream allows disabling compression of Server-Sent Events responses,
+// those with a text/event-stream Content-Type, even if their type is allowed by
+// ContentTypes. Compressed event streams are flushed as the handler flushes them.
+func SkipEventStream(skip bool) option {
+	return func(h *handler) {
+		h.skipEventStream = skip
+	}
+}
+
+// encoder is implemented by all the compression writers supported by the handler.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// newEncoder returns a compression writer for the given content-coding and level.
+func newEncoder(encoding string, level int, w io.Writer) (encoder, error) {
+	switch encoding {
+	case brEncoding:
+		return brotli.NewWriterLevel(w, level), nil
+	case zstdEncoding:
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevel(level)), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zw, nil
+	case gzipEncoding:
+		gw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+		return gw, nil
+	case deflateEncoding:
+		// The "deflate" content-coding is the zlib format, not a raw deflate stream.
+		zw, err := zlib.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+		return zw, nil
+	}
+	return nil, fmt.Errorf("compressor: unsupported encoding %q", encoding)
+}
+
+// poolKey identifies an encoder pool.
+type poolKey struct {
+	encoding string
+	level    int
+}
+
+// Encoders hold large compression states, so they are pooled per content-coding
+// and compression level, and shared by all handlers.
+var (
+	poolsMu sync.Mutex
+	pools   = make(map[poolKey]*sync.Pool)
+)
+
+// encoderPool returns the pool of encoders for the given content-coding and level.
+func encoderPool(encoding string, level int) *sync.Pool {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	key := poolKey{encoding, level}
+	if p, ok := pools[key]; ok {
+		return p
+	}
+
+	p := &sync.Pool{
+		New: func() interface{} {
+			enc, err := newEncoder(encoding, level, ioutil.Discard)
+			if err != nil {
+				return nil
+			}
+			return enc
+		},
+	}
+	pools[key] = p
+	return p
+}
+
+// level returns the compression level configured for the given content-coding.
+func (h *handler) level(encoding string) int {
+	switch encoding {
+	case brEncoding:
+		return h.brotliLevel
+	case zstdEncoding:
+		return int(zstd.SpeedDefault)
+	}
+	return h.compressionLevel
+}
+
+// getEncoder takes an encoder from the pool and resets it to write to w.
+func (h *handler) getEncoder(encoding string, w io.Writer) (encoder, error) {
+	enc, ok := h.pools[encoding].Get().(encoder)
+	if !ok {
+		return nil, fmt.Errorf("compressor: invalid %s compression level %d", encoding, h.level(encoding))
+	}
+	enc.Reset(w)
+	return enc, nil
+}
+
+// putEncoder returns the encoder to the pool.
+func (h *handler) putEncoder(encoding string, enc encoder) {
+	h.pools[encoding].Put(enc)
+}
+
+// Compressed response writer wrapper. It holds back the response headers and
+// buffers up to the configured minimum size of the body before deciding whether
+// to compress it or not.
+type responseWriter struct {
+	internal.ResponseWriter
+	handler  *handler
+	request  *http.Request
+	encoding string
+	encoder  encoder
+	buf      []byte
+	status   int
+	decided  bool
+	skip     SkipReason
+	// served is set once the handler returned, it is left unset if it panicked.
+	served bool
+	// written and elapsed are the uncompressed bytes written and the time spent in
+	// the encoder, respectively.
+	written int64
+	elapsed time.Duration
+	// etagDecoded is set when If-None-Match referred to an encoded representation.
+	etagDecoded bool
+}
+
+// WriteHeader records the status code. Headers are sent once the response
+// writer decides whether the body is going to be compressed or not, except for
+// informational responses, such as 103 Early Hints, which are sent right away
+// while waiting for the final status.
+func (rw *responseWriter) WriteHeader(status int) {
+	if status >= 100 && status <= 199 && status != http.StatusSwitchingProtocols {
+		if rw.status == 0 {
+			rw.ResponseWriter.WriteHeader(status)
+		}
+		return
+	}
+
+	if rw.status == 0 {
+		rw.status = status
+	}
+}
+
+// Status returns the status code of the response or 0 if the response has not been written.
+func (rw *responseWriter) Status() int {
+	return rw.status
+}
+
+// Written returns whether or not the response has been written.
+func (rw *responseWriter) Written() bool {
+	return rw.status != 0
+}
+
+// Write buffers bytes until the minimum size for compression is reached, from that
+// point on, they are written to the encoder or straight to the client if the
+// response is not going to be compressed.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		// The status will be StatusOK if WriteHeader has not been called yet
+		rw.status = http.StatusOK
+	}
+	rw.written += int64(len(b))
+
+	if !rw.decided {
+		rw.buf = append(rw.buf, b...)
+		if len(rw.buf) < rw.handler.minSize {
+			return len(b), nil
+		}
+		return len(b), rw.decide(false)
+	}
+
+	if rw.encoder != nil {
+		start := time.Now()
+		n, err := rw.encoder.Write(b)
+		rw.elapsed += time.Since(start)
+		return n, err
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// decide determines whether the response body is going to be compressed, sends
+// the response headers and writes out the buffered data. It will also set the
+// Content-Type header using the net/http library content type detection if the
+// Content-Type header was not set yet. final indicates that the buffered data is
+// the whole response body.
+func (rw *responseWriter) decide(final bool) error {
+	rw.decided = true
+
+	headers := rw.Header()
+	if headers.Get(contentType) == "" && len(rw.buf) > 0 {
+		headers.Set(contentType, http.DetectContentType(rw.buf))
+	}
+
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+
+	rw.skip = rw.skipReason(final)
+	if rw.skip == "" {
+		enc, err := rw.handler.getEncoder(rw.encoding, rw.ResponseWriter)
+		if err != nil {
+			rw.skip = SkipEncoderError
+		} else {
+			rw.encoder = enc
+			headers.Set(contentEncoding, rw.encoding)
+			addVary(headers, acceptEncoding)
+			if tag := headers.Get(etag); tag != "" {
+				headers.Set(etag, encodeETag(tag, rw.encoding))
+			}
+			// Any length set by the inner handler describes the uncompressed body.
+			headers.Del(contentLength)
+		}
+	}
+	headers.Del(SkipHeader)
+
+	// The client's cached copy is the encoded representation.
+	if rw.status == http.StatusNotModified && rw.etagDecoded {
+		if tag := headers.Get(etag); tag != "" {
+			headers.Set(etag, encodeETag(tag, rw.encoding))
+		}
+	}
+
+	rw.ResponseWriter.WriteHeader(rw.status)
+
+	buf := rw.buf
+	rw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if rw.encoder != nil {
+		start := time.Now()
+		_, err = rw.encoder.Write(buf)
+		rw.elapsed += time.Since(start)
+	} else {
+		_, err = rw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// skipReason returns why the buffered response is not worth compressing, or an empty
+// reason if it is. The minimum size is only enforced once the whole body is known,
+// streamed responses flushed early are compressed regardless of their size.
+func (rw *responseWriter) skipReason(final bool) SkipReason {
+	if !bodyAllowed(rw.request.Method, rw.status) {
+		return SkipNoBody
+	}
+
+	// Byte ranges refer to the uncompressed representation.
+	if rw.status == http.StatusPartialContent {
+		return SkipPartialContent
+	}
+
+	headers := rw.Header()
+
+	// The handler opted out of compression for this response.
+	if headers.Get(SkipHeader) != "" {
+		return SkipOptOut
+	}
+
+	// Skip compression if response body is encoded already.
+	curEncoding := headers.Get(contentEncoding)
+	if curEncoding != "" && curEncoding != identityEncoding {
+		return SkipEncoded
+	}
+
+	if final && (len(rw.buf) == 0 || len(rw.buf) < rw.handler.minSize) {
+		return SkipTooSmall
+	}
+
+	if !rw.handler.compressibleType(headers.Get(contentType)) {
+		return SkipContentType
+	}
+	return ""
+}
+
+// Flush sends any buffered data to the client. When the response is being compressed,
+// the encoder is flushed first so that the data written so far can be decoded by the
+// client right away, as needed by Server-Sent Events and long-polling responses.
+func (rw *responseWriter) Flush() {
+	if !rw.decided {
+		if err := rw.decide(false); err != nil {
+			return
+		}
+	}
+
+	if rw.encoder != nil {
+		start := time.Now()
+		err := rw.encoder.Flush()
+		rw.elapsed += time.Since(start)
+		if err != nil {
+			return
+		}
+	}
+	rw.ResponseWriter.Flush()
+}
+
+// close makes sure the response headers are sent, even if the body was never
+// written or is smaller than the minimum size, finishes the compressed stream and
+// reports the compression stats. If the handler panicked, the response is left as
+// is for whoever recovers from the panic to write it.
+func (rw *responseWriter) close() error {
+	if !rw.served {
+		if rw.encoder != nil {
+			rw.handler.putEncoder(rw.encoding, rw.encoder)
+			rw.encoder = nil
+		}
+		return nil
+	}
+
+	var err error
+	if !rw.decided {
+		err = rw.decide(true)
+	}
+
+	if rw.encoder != nil {
+		start := time.Now()
+		if cerr := rw.encoder.Close(); err == nil {
+			err = cerr
+		}
+		rw.elapsed += time.Since(start)
+
+		rw.handler.putEncoder(rw.encoding, rw.encoder)
+		rw.encoder = nil
+
+		rw.handler.observe(rw.request, Stats{
+			Encoding:          rw.encoding,
+			UncompressedBytes: rw.written,
+			CompressedBytes:   int64(rw.ResponseWriter.Size()),
+			Duration:          rw.elapsed,
+		})
+		return err
+	}
+
+	rw.handler.observe(rw.request, Stats{
+		UncompressedBytes: rw.written,
+		CompressedBytes:   rw.written,
+		SkipReason:        rw.skip,
+	})
+	return err
+}
+
+// Handler compresses the response body using the content-coding that best matches
+// the request's Accept-Encoding header, except in the following scenarios:
+// * The response body is already encoded
+// * The request's Accept-Encoding header does not announce any of the configured encodings
+// * The request is upgrading to a websocket connection.
+// * The request is excluded, see Exclude, ExcludePaths and ExcludeMethods.
+// * The response sets the SkipHeader marker.
+// * The request method is HEAD or the response status does not allow a body, such as 204 or 304.
+// * The response body is smaller than the minimum size, see MinSize.
+// * The response's Content-Type is not allowed to be compressed, see ContentTypes.
+//
+// By default, encodings are preferred in the following order: br, zstd, gzip and deflate.
+//
+// ETags of compressed responses are suffixed with the content-coding, "abc" becomes
+// "abc-gzip", and If-None-Match values are translated back before reaching h, so
+// conditional requests served by http.ServeContent keep working.
+func Handler(h http.Handler, opts ...option) http.Handler {
+	handler := newHandler(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hdr := r.Header
+
+		// Skip compression if response body is encoded already.
+		curEncoding := w.Header().Get(contentEncoding)
+		if curEncoding != "" && curEncoding != identityEncoding {
+			handler.serveUncompressed(h, w, r, SkipEncoded)
+			return
+		}
+
+		// Compression was disabled for this request.
+		if handler.excluded(r) {
+			handler.serveUncompressed(h, w, r, SkipExcluded)
+			return
+		}
+
+		// This handler does not support websockets compression
+		if hdr.Get(secWebSocketKey) != "" {
+			handler.serveUncompressed(h, w, r, SkipWebSocket)
+			return
+		}
+
+		// If user-agent does not accept any of our encodings,
+		// skip compression.
+		encoding := negotiate(hdr.Get(acceptEncoding), handler.encodings)
+		if encoding == "" {
+			handler.serveUncompressed(h, w, r, SkipNotAcceptable)
+			return
+		}
+
+		rw := &responseWriter{
+			ResponseWriter: internal.NewResponseWriter(w),
+			handler:        handler,
+			request:        r,
+			encoding:       encoding,
+			etagDecoded:    decodeIfNoneMatch(hdr, encoding),
+		}
+		defer rw.close()
+
+		h.ServeHTTP(rw, r)
+		rw.served = true
+	})
+}
+
+// bodyAllowed returns whether a response to the given request method and with the
+// given status code is permitted to have a body, as described in RFC 7230 section 3.3.
+func bodyAllowed(method string, status int) bool {
+	if method == http.MethodHead {
+		return false
+	}
+
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// compressibleType returns whether the given Content-Type is in the list of
+// types allowed to be compressed.
+func (h *handler) compressibleType(ct string) bool {
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if h.skipEventStream && err == nil && mediaType == eventStream {
+		return false
+	}
+
+	if len(h.contentTypes) == 0 {
+		return true
+	}
+
+	if err != nil {
+		return false
+	}
+
+	for _, t := range h.contentTypes {
+		if t == mediaType {
+			return true
+		}
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// newHandler returns a handler with the default options, overridden by opts.
+func newHandler(opts []option) *handler {
+	// Default options
+	handler := &handler{
+		compressionLevel: gzip.DefaultCompression,
+		brotliLevel:      brotli.DefaultCompression,
+		encodings:        []string{brEncoding, zstdEncoding, gzipEncoding, deflateEncoding},
+		minSize:          DefaultMinSize,
+		contentTypes:     defaultContentTypes,
+		maxBodySize:      DefaultMaxBodySize,
+	}
+
+	for _, opt := range opts {
+		opt(handler)
+	}
+
+	for _, e := range handler.encodings {
+		switch e {
+		case brEncoding, zstdEncoding, gzipEncoding, deflateEncoding:
+		default:
+			panic(fmt.Sprintf("compressor: unsupported encoding %q", e))
+		}
+	}
+
+	handler.pools = make(map[string]*sync.Pool, len(handler.encodings))
+	for _, e := range handler.encodings {
+		handler.pools[e] = encoderPool(e, handler.level(e))
+	}
+	return handler
+}
+
+// addVary appends the given header name to the Vary header, unless it is
+// already listed.
+func addVary(headers http.Header, name string) {
+	for _, v := range headers.Values(vary) {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), name) {
+				return
+			}
+		}
+	}
+	headers.Add(vary, name)
+}
+
+// negotiate returns the content-coding, out of the ones supported by the server,
+// that the client prefers according to the quality values sent in the
+// Accept-Encoding header. Ties are broken using the server's order of preference.
+// An empty string is returned if none of the encodings are acceptable.
+func negotiate(header string, encodings []string) string {
+	if header == "" {
+		return ""
+	}
+
+	accepted := parseAcceptEncoding(header)
+	wildcard, hasWildcard := accepted["*"]
+
+	best, bestQ := "", 0.0
+	for _, e := range encodings {
+		q, ok := accepted[e]
+		if !ok {
+			if !hasWildcard {
+				continue
+			}
+			q = wildcard
+		}
+
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+// parseAcceptEncoding parses an Accept-Encoding header value into a map of
+// content-codings and their quality values, as described in RFC 7231 section 5.3.4.
+// Malformed quality values are treated as zero, making the coding unacceptable.
+func parseAcceptEncoding(header string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		coding, params := part, ""
+		if i := strings.IndexByte(part, ';'); i >= 0 {
+			coding, params = part[:i], part[i+1:]
+		}
+
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		// Some old clients still announce the legacy x-gzip alias.
+		if coding == "x-gzip" {
+			coding = gzipEncoding
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "q") {
+				continue
+			}
+
+			v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			if err != nil || v < 0 || v > 1 {
+				v = 0
+			}
+			q = v
+		}
+		accepted[coding] = q
+	}
+	return accepted
+}
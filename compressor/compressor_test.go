@@ -0,0 +1,264 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package compressor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/c4milo/handlers/logger"
+	"github.com/hooklift/assert"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiate(t *testing.T) {
+	all := []string{brEncoding, zstdEncoding, gzipEncoding, deflateEncoding}
+
+	tests := []struct {
+		header    string
+		encodings []string
+		expected  string
+	}{
+		{"", all, ""},
+		{"gzip", all, gzipEncoding},
+		{"gzip, deflate, br", all, brEncoding},
+		{"gzip, deflate, br, zstd", all, brEncoding},
+		{"gzip, deflate, br, zstd", []string{zstdEncoding, gzipEncoding}, zstdEncoding},
+		{"br;q=0.5, gzip;q=0.8", all, gzipEncoding},
+		{"br;q=0, gzip", all, gzipEncoding},
+		{"GZIP;Q=0.5", all, gzipEncoding},
+		{"x-gzip", all, gzipEncoding},
+		{"*", all, brEncoding},
+		{"*;q=0.2, gzip;q=0.5", all, gzipEncoding},
+		{"*, br;q=0", all, zstdEncoding},
+		{"identity", all, ""},
+		{"gzip;q=bogus", all, ""},
+		{"gzip;q=2", all, ""},
+		{"br", []string{gzipEncoding}, ""},
+		{" , gzip ; q=1 ,", all, gzipEncoding},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equals(t, tt.expected, negotiate(tt.header, tt.encodings))
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello world.")
+	})
+
+	ts := httptest.NewServer(Handler(requestHandler, MinSize(0)))
+	defer ts.Close()
+
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+		reader         func(io.Reader) (io.Reader, error)
+	}{
+		{"br", brEncoding, func(r io.Reader) (io.Reader, error) {
+			return brotli.NewReader(r), nil
+		}},
+		{"zstd", zstdEncoding, func(r io.Reader) (io.Reader, error) {
+			return zstd.NewReader(r)
+		}},
+		{"deflate", deflateEncoding, func(r io.Reader) (io.Reader, error) {
+			return zlib.NewReader(r)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL, nil)
+			assert.Ok(t, err)
+			req.Header.Set(acceptEncoding, tt.acceptEncoding)
+
+			resp, err := http.DefaultClient.Do(req)
+			assert.Ok(t, err)
+			defer resp.Body.Close()
+
+			assert.Equals(t, tt.expected, resp.Header.Get(contentEncoding))
+			assert.Equals(t, acceptEncoding, resp.Header.Get(vary))
+
+			r, err := tt.reader(resp.Body)
+			assert.Ok(t, err)
+
+			body, err := ioutil.ReadAll(r)
+			assert.Ok(t, err)
+			assert.Equals(t, "Hello world.", string(body))
+		})
+	}
+}
+
+func TestHandlerNotAcceptable(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello world.")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, "br;q=0, identity")
+	rec := httptest.NewRecorder()
+
+	Handler(requestHandler, MinSize(0)).ServeHTTP(rec, req)
+
+	assert.Equals(t, "", rec.Header().Get(contentEncoding))
+	assert.Equals(t, "", rec.Header().Get(vary))
+	assert.Equals(t, "Hello world.", rec.Body.String())
+}
+
+func TestHandlerSkipCompression(t *testing.T) {
+	text := strings.Repeat("Hello world. ", 200)
+	png := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), make([]byte, 2048)...)
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		opts        []option
+		compressed  bool
+	}{
+		{"large text", []byte(text), "", nil, true},
+		{"below minimum size", []byte("Hello world."), "", nil, false},
+		{"custom minimum size", []byte("Hello world."), "", []option{MinSize(10)}, true},
+		{"detected png", png, "", nil, false},
+		{"explicit json", []byte(text), "application/json; charset=utf-8", nil, true},
+		{"explicit zip", []byte(text), "application/zip", nil, false},
+		{"custom allowlist", png, "", []option{ContentTypes("image/*")}, true},
+		{"empty allowlist", []byte(text), "application/zip", []option{ContentTypes()}, true},
+		{"empty body", nil, "", []option{MinSize(0)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set(contentType, tt.contentType)
+				}
+				// Write in small chunks to exercise buffering.
+				for b := tt.body; len(b) > 0; {
+					n := 100
+					if len(b) < n {
+						n = len(b)
+					}
+					w.Write(b[:n])
+					b = b[n:]
+				}
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(acceptEncoding, gzipEncoding)
+			rec := httptest.NewRecorder()
+
+			Handler(requestHandler, tt.opts...).ServeHTTP(rec, req)
+
+			assert.Equals(t, http.StatusOK, rec.Code)
+			if !tt.compressed {
+				assert.Equals(t, "", rec.Header().Get(contentEncoding))
+				assert.Equals(t, "", rec.Header().Get(vary))
+				assert.Equals(t, string(tt.body), rec.Body.String())
+				return
+			}
+
+			assert.Equals(t, gzipEncoding, rec.Header().Get(contentEncoding))
+			assert.Equals(t, acceptEncoding, rec.Header().Get(vary))
+
+			gr, err := gzip.NewReader(rec.Body)
+			assert.Ok(t, err)
+			body, err := ioutil.ReadAll(gr)
+			assert.Ok(t, err)
+			assert.Equals(t, string(tt.body), string(body))
+		})
+	}
+}
+
+func TestHandlerDeferredStatus(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Not found")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, gzipEncoding)
+	rec := httptest.NewRecorder()
+
+	Handler(requestHandler).ServeHTTP(rec, req)
+
+	assert.Equals(t, http.StatusNotFound, rec.Code)
+	assert.Equals(t, "text/plain; charset=utf-8", rec.Header().Get(contentType))
+	assert.Equals(t, "Not found", rec.Body.String())
+}
+
+func TestHandlerInformationalStatus(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</app.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, strings.Repeat("Not found. ", 200))
+	})
+
+	ts := httptest.NewServer(Handler(requestHandler))
+	defer ts.Close()
+
+	var informational []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			informational = append(informational, code)
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	assert.Ok(t, err)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	req.Header.Set(acceptEncoding, gzipEncoding)
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	assert.Ok(t, err)
+	defer resp.Body.Close()
+
+	assert.Equals(t, []int{http.StatusEarlyHints}, informational)
+	assert.Equals(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equals(t, gzipEncoding, resp.Header.Get(contentEncoding))
+
+	gr, err := gzip.NewReader(resp.Body)
+	assert.Ok(t, err)
+	body, err := ioutil.ReadAll(gr)
+	assert.Ok(t, err)
+	assert.Equals(t, strings.Repeat("Not found. ", 200), string(body))
+}
+
+func TestHandlerPanic(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		fmt.Fprint(w, "partial")
+		panic("boom")
+	})
+
+	var buf bytes.Buffer
+	recovered := logger.Handler(Handler(requestHandler), logger.Output(&buf), logger.Recover(true))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, gzipEncoding)
+	rec := httptest.NewRecorder()
+
+	recovered.ServeHTTP(rec, req)
+
+	assert.Equals(t, http.StatusInternalServerError, rec.Code)
+	assert.Equals(t, "", rec.Header().Get(contentEncoding))
+	assert.Equals(t, http.StatusText(http.StatusInternalServerError)+"\n", rec.Body.String())
+}
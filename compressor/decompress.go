@@ -0,0 +1,124 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package compressor
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// MaxBodySize sets the maximum size, in bytes, a request body is allowed to have once
+// decompressed by DecompressHandler. Reading past it fails, protecting the server
+// against decompression bombs. A value of zero or less disables the limit.
+// Defaults to DefaultMaxBodySize.
+func MaxBodySize(n int64) option {
+	return func(h *handler) {
+		h.maxBodySize = n
+	}
+}
+
+// newDecoder returns a decompressing reader for the given content-coding.
+func newDecoder(encoding string, r io.Reader, maxSize int64) (io.ReadCloser, error) {
+	switch encoding {
+	case brEncoding:
+		return ioutil.NopCloser(brotli.NewReader(r)), nil
+	case zstdEncoding:
+		opts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+		if maxSize > 0 {
+			opts = append(opts, zstd.WithDecoderMaxMemory(uint64(maxSize)))
+		}
+		zr, err := zstd.NewReader(r, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case gzipEncoding:
+		return gzip.NewReader(r)
+	case deflateEncoding:
+		return zlib.NewReader(r)
+	}
+	return nil, fmt.Errorf("compressor: unsupported encoding %q", encoding)
+}
+
+// requestBody replaces the original request body with its decompressed version.
+type requestBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+// Close closes the decoder as well as the original request body.
+func (b *requestBody) Close() error {
+	err := b.ReadCloser.Close()
+	if cerr := b.body.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// DecompressHandler transparently decompresses request bodies sent with a
+// Content-Encoding header. Any of the encodings configured through Encodings are
+// accepted, by default: br, zstd, gzip and deflate.
+//
+// Requests using any other content-coding are rejected with 415 Unsupported Media Type,
+// and requests whose body cannot be decoded with 400 Bad Request. Decompressed
+// bodies are limited in size, see MaxBodySize.
+func DecompressHandler(h http.Handler, opts ...option) http.Handler {
+	handler := newHandler(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get(contentEncoding)))
+		if encoding == "" || encoding == identityEncoding || r.Body == nil || r.Body == http.NoBody {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if encoding == "x-gzip" {
+			encoding = gzipEncoding
+		}
+
+		if !handler.accepts(encoding) {
+			// RFC 7694 section 3 advises announcing the supported encodings.
+			w.Header().Set(acceptEncoding, strings.Join(handler.encodings, ", "))
+			http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		dec, err := newDecoder(encoding, r.Body, handler.maxBodySize)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		var body io.ReadCloser = &requestBody{dec, r.Body}
+		if handler.maxBodySize > 0 {
+			body = http.MaxBytesReader(w, body, handler.maxBodySize)
+		}
+
+		r.Body = body
+		r.ContentLength = -1
+		r.Header.Del(contentEncoding)
+		r.Header.Del(contentLength)
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// accepts returns whether the handler is configured to use the given content-coding.
+func (h *handler) accepts(encoding string) bool {
+	for _, e := range h.encodings {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package compressor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+// echoHandler replies with the request body, or 413 if it is too large.
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("X-Content-Encoding", r.Header.Get(contentEncoding))
+	w.Write(body)
+})
+
+// compress encodes data using the given content-coding.
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	enc, err := newEncoder(encoding, newHandler(nil).level(encoding), &buf)
+	assert.Ok(t, err)
+	_, err = enc.Write(data)
+	assert.Ok(t, err)
+	assert.Ok(t, enc.Close())
+	return buf.Bytes()
+}
+
+func TestDecompressHandler(t *testing.T) {
+	payload := []byte(strings.Repeat(`{"hello":"world"}`, 100))
+
+	for _, encoding := range []string{brEncoding, zstdEncoding, gzipEncoding, deflateEncoding} {
+		t.Run(encoding, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(compress(t, encoding, payload)))
+			req.Header.Set(contentEncoding, encoding)
+			rec := httptest.NewRecorder()
+
+			DecompressHandler(echoHandler).ServeHTTP(rec, req)
+
+			assert.Equals(t, http.StatusOK, rec.Code)
+			assert.Equals(t, "", rec.Header().Get("X-Content-Encoding"))
+			assert.Equals(t, string(payload), rec.Body.String())
+		})
+	}
+}
+
+func TestDecompressHandlerRejects(t *testing.T) {
+	bomb := bytes.Repeat([]byte{0}, 1<<20)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		opts     []option
+		status   int
+	}{
+		{"identity", identityEncoding, []byte("hello"), nil, http.StatusOK},
+		{"unsupported", "compress", []byte("hello"), nil, http.StatusUnsupportedMediaType},
+		{"not configured", brEncoding, compress(t, brEncoding, []byte("hello")), []option{Encodings(gzipEncoding)}, http.StatusUnsupportedMediaType},
+		{"corrupted", gzipEncoding, []byte("hello"), nil, http.StatusBadRequest},
+		{"gzip bomb", gzipEncoding, compress(t, gzipEncoding, bomb), []option{MaxBodySize(1 << 10)}, http.StatusRequestEntityTooLarge},
+		// zstd frames declare their size, so the decoder refuses them before reading.
+		{"zstd bomb", zstdEncoding, compress(t, zstdEncoding, bomb), []option{MaxBodySize(1 << 10)}, http.StatusBadRequest},
+		{"unlimited", gzipEncoding, compress(t, gzipEncoding, bomb), []option{MaxBodySize(0)}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(tt.body))
+			req.Header.Set(contentEncoding, tt.encoding)
+			rec := httptest.NewRecorder()
+
+			DecompressHandler(echoHandler, tt.opts...).ServeHTTP(rec, req)
+
+			assert.Equals(t, tt.status, rec.Code)
+			if tt.status == http.StatusUnsupportedMediaType {
+				assert.Cond(t, rec.Header().Get(acceptEncoding) != "", "Accept-Encoding should announce the supported encodings")
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package compressor
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	etag        = "ETag"
+	ifNoneMatch = "If-None-Match"
+)
+
+// encodeETag suffixes the given entity-tag with the content-coding, so that each
+// encoded representation has its own, "abc" becomes "abc-gzip". Weak tags keep
+// their W/ prefix.
+func encodeETag(tag, encoding string) string {
+	if len(tag) < 2 || !strings.HasSuffix(tag, `"`) {
+		return tag
+	}
+	return tag[:len(tag)-1] + "-" + encoding + `"`
+}
+
+// decodeETag removes the content-coding suffix added by encodeETag. It returns
+// false if the entity-tag was not suffixed with the given content-coding.
+func decodeETag(tag, encoding string) (string, bool) {
+	suffix := "-" + encoding + `"`
+	if !strings.HasSuffix(tag, suffix) {
+		return tag, false
+	}
+	return tag[:len(tag)-len(suffix)] + `"`, true
+}
+
+// decodeIfNoneMatch translates the entity-tags of encoded representations in the
+// If-None-Match header back to the ones known by the inner handler, so that
+// conditional requests keep working behind the compressor. It returns whether any
+// entity-tag was translated.
+func decodeIfNoneMatch(headers http.Header, encoding string) bool {
+	value := headers.Get(ifNoneMatch)
+	if value == "" || value == "*" {
+		return false
+	}
+
+	var (
+		tags    []string
+		decoded bool
+	)
+	for s := value; ; {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			break
+		}
+
+		tag, rest := scanETag(s)
+		if tag == "" {
+			// Malformed header, leave it untouched.
+			return false
+		}
+
+		if t, ok := decodeETag(tag, encoding); ok {
+			tag, decoded = t, true
+		}
+		tags = append(tags, tag)
+		s = rest
+	}
+
+	if decoded {
+		headers.Set(ifNoneMatch, strings.Join(tags, ", "))
+	}
+	return decoded
+}
+
+// scanETag returns the entity-tag at the beginning of s and the remaining string.
+// An empty entity-tag is returned if s does not start with a valid one.
+func scanETag(s string) (tag, rest string) {
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+
+	if len(s) < start+2 || s[start] != '"' {
+		return "", s
+	}
+
+	end := strings.IndexByte(s[start+1:], '"')
+	if end < 0 {
+		return "", s
+	}
+	end += start + 2
+	return s[:end], s[end:]
+}
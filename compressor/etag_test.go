@@ -0,0 +1,82 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package compressor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hooklift/assert"
+)
+
+func TestDecodeIfNoneMatch(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+		decoded  bool
+	}{
+		{`"abc-gzip"`, `"abc"`, true},
+		{`W/"abc-gzip"`, `W/"abc"`, true},
+		{`"abc-br", "def-gzip"`, `"abc-br", "def"`, true},
+		{`"a,b-gzip"`, `"a,b"`, true},
+		{`"abc"`, `"abc"`, false},
+		{`"abc-br"`, `"abc-br"`, false},
+		{`*`, `*`, false},
+		{`abc-gzip`, `abc-gzip`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			headers := http.Header{}
+			headers.Set(ifNoneMatch, tt.header)
+			assert.Equals(t, tt.decoded, decodeIfNoneMatch(headers, gzipEncoding))
+			assert.Equals(t, tt.expected, headers.Get(ifNoneMatch))
+		})
+	}
+}
+
+func TestHandlerETag(t *testing.T) {
+	content := strings.NewReader(strings.Repeat("Hello world. ", 200))
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(etag, `"v1"`)
+		http.ServeContent(w, r, "hello.txt", time.Time{}, content)
+	})
+	compressHandler := Handler(requestHandler)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		ifNoneMatch    string
+		status         int
+		etag           string
+	}{
+		{"compressed", gzipEncoding, "", http.StatusOK, `"v1-gzip"`},
+		{"identity", "", "", http.StatusOK, `"v1"`},
+		{"compressed not modified", gzipEncoding, `"v1-gzip"`, http.StatusNotModified, `"v1-gzip"`},
+		{"identity not modified", gzipEncoding, `"v1"`, http.StatusNotModified, `"v1"`},
+		{"other encoding modified", brEncoding, `"v1-gzip"`, http.StatusOK, `"v1-br"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set(acceptEncoding, tt.acceptEncoding)
+			}
+			if tt.ifNoneMatch != "" {
+				req.Header.Set(ifNoneMatch, tt.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+
+			compressHandler.ServeHTTP(rec, req)
+
+			assert.Equals(t, tt.status, rec.Code)
+			assert.Equals(t, tt.etag, rec.Header().Get(etag))
+		})
+	}
+}
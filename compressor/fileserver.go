@@ -0,0 +1,154 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package compressor
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/c4milo/handlers/internal"
+)
+
+// indexPage is the file served for directory requests.
+const indexPage = "index.html"
+
+// precompressedExts maps content-codings to the file extensions used by
+// precompressed siblings of static assets.
+var precompressedExts = map[string]string{
+	brEncoding:   ".br",
+	zstdEncoding: ".zst",
+	gzipEncoding: ".gz",
+}
+
+// FileServer returns a handler that serves HTTP requests with the contents of the
+// file system rooted at root, like http.FileServer does. When the client accepts
+// it, precompressed siblings of the requested file are served instead of the file
+// itself, for instance app.js.br or app.js.gz for app.js. The following extensions
+// are looked up: .br, .zst and .gz. Siblings of files which do not exist are ignored.
+// Directory requests are served the siblings of their index.html page.
+//
+// Precompressed files are served with the Content-Type of the original file's
+// extension, their own ETag and support for Range requests. If no sibling exists
+// for any of the encodings accepted by the client, the file is compressed on the
+// fly as Handler does. Options are the same as Handler's, the stats of precompressed
+// responses are reported to the Observer with their Encoding too. Excluded requests,
+// see Exclude, are never served precompressed siblings.
+func FileServer(root http.FileSystem, opts ...option) http.Handler {
+	handler := newHandler(opts)
+	fallback := Handler(http.FileServer(root), opts...)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Excluded requests are served uncompressed by the fallback.
+		if handler.excluded(r) {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		// http.FileServer redirects index pages to their directory.
+		if strings.HasSuffix(r.URL.Path, "/"+indexPage) {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		name := r.URL.Path
+		if !strings.HasPrefix(name, "/") {
+			name = "/" + name
+		}
+		dir := strings.HasSuffix(name, "/")
+		name = path.Clean(name)
+		if dir {
+			// Directories are served their index page, as http.FileServer does.
+			name = path.Join(name, indexPage)
+		}
+
+		// Siblings are only served in place of an existing file.
+		original, err := stat(root, name)
+		if err != nil || original.IsDir() {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		// Only negotiate among the encodings for which a sibling exists.
+		var available []string
+		for _, e := range handler.encodings {
+			ext, ok := precompressedExts[e]
+			if !ok {
+				continue
+			}
+			if fi, err := stat(root, name+ext); err == nil && !fi.IsDir() {
+				available = append(available, e)
+			}
+		}
+
+		encoding := negotiate(r.Header.Get(acceptEncoding), available)
+		if encoding == "" {
+			if len(available) > 0 {
+				// The representation served depends on Accept-Encoding anyway.
+				addVary(w.Header(), acceptEncoding)
+			}
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		f, err := root.Open(name + precompressedExts[encoding])
+		if err != nil {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		ct := mime.TypeByExtension(path.Ext(name))
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+
+		headers := w.Header()
+		headers.Set(contentType, ct)
+		headers.Set(contentEncoding, encoding)
+		headers.Set("ETag", fileETag(fi, encoding))
+		addVary(headers, acceptEncoding)
+
+		rw := internal.NewResponseWriter(w)
+		http.ServeContent(rw, r, name, fi.ModTime(), f)
+
+		stats := Stats{Encoding: encoding, CompressedBytes: int64(rw.Size())}
+		// The original file is the uncompressed body of complete responses only.
+		if stats.CompressedBytes == fi.Size() {
+			stats.UncompressedBytes = original.Size()
+		}
+		handler.observe(r, stats)
+	})
+}
+
+// stat returns the FileInfo of the named file in the given file system.
+func stat(root http.FileSystem, name string) (os.FileInfo, error) {
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// fileETag returns a strong ETag for a precompressed file, built out of its
+// modification time and size, and suffixed with its content-coding.
+func fileETag(fi os.FileInfo, encoding string) string {
+	return fmt.Sprintf(`"%x-%x-%s"`, fi.ModTime().UnixNano(), fi.Size(), encoding)
+}
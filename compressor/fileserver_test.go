@@ -0,0 +1,163 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package compressor
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hooklift/assert"
+)
+
+func TestFileServer(t *testing.T) {
+	css := []byte(strings.Repeat("body { color: red; }\n", 100))
+	html := []byte("<!DOCTYPE html>" + strings.Repeat("<p>Hello world.</p>\n", 100))
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	fsys := fstest.MapFS{
+		"app.css":       {Data: css, ModTime: modTime},
+		"app.css.br":    {Data: compress(t, brEncoding, css), ModTime: modTime},
+		"app.css.gz":    {Data: compress(t, gzipEncoding, css), ModTime: modTime},
+		"plain.css":     {Data: css, ModTime: modTime},
+		"secret.txt.gz": {Data: compress(t, gzipEncoding, css), ModTime: modTime},
+		"index.html":    {Data: html, ModTime: modTime},
+		"index.html.br": {Data: compress(t, brEncoding, html), ModTime: modTime},
+	}
+	ts := httptest.NewServer(FileServer(http.FS(fsys)))
+	defer ts.Close()
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		header         http.Header
+		status         int
+		encoding       string
+		body           []byte
+	}{
+		{"brotli sibling", "/app.css", "gzip, br", nil, http.StatusOK, brEncoding, fsys["app.css.br"].Data},
+		{"gzip sibling", "/app.css", "gzip", nil, http.StatusOK, gzipEncoding, fsys["app.css.gz"].Data},
+		{"client preference", "/app.css", "br;q=0.5, gzip", nil, http.StatusOK, gzipEncoding, fsys["app.css.gz"].Data},
+		{"identity", "/app.css", "identity", nil, http.StatusOK, "", css},
+		{"range", "/app.css", "gzip", http.Header{"Range": {"bytes=0-9"}}, http.StatusPartialContent, gzipEncoding, fsys["app.css.gz"].Data[:10]},
+		{"on the fly", "/plain.css", "zstd, gzip", nil, http.StatusOK, zstdEncoding, nil},
+		{"not found", "/missing.css", "gzip", nil, http.StatusNotFound, "", nil},
+		{"sibling without original", "/secret.txt", "gzip", nil, http.StatusNotFound, "", nil},
+		{"directory index", "/", "br", nil, http.StatusOK, brEncoding, fsys["index.html.br"].Data},
+		{"index redirect with sibling", "/index.html", "br", nil, http.StatusMovedPermanently, "", nil},
+		{"index redirect", "/index.html", "gzip", nil, http.StatusMovedPermanently, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL+tt.path, nil)
+			assert.Ok(t, err)
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			req.Header.Set(acceptEncoding, tt.acceptEncoding)
+
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			assert.Ok(t, err)
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.Ok(t, err)
+
+			assert.Equals(t, tt.status, resp.StatusCode)
+			assert.Equals(t, tt.encoding, resp.Header.Get(contentEncoding))
+			if tt.body != nil {
+				assert.Equals(t, string(tt.body), string(body))
+			}
+			if resp.StatusCode < 300 {
+				assert.Equals(t, acceptEncoding, resp.Header.Get(vary))
+			}
+			if resp.StatusCode < 300 && strings.HasSuffix(tt.path, ".css") {
+				assert.Equals(t, mime.TypeByExtension(".css"), resp.Header.Get(contentType))
+			}
+		})
+	}
+}
+
+func TestFileServerConditional(t *testing.T) {
+	css := []byte(strings.Repeat("body { color: red; }\n", 100))
+	fsys := fstest.MapFS{
+		"app.css":    {Data: css},
+		"app.css.gz": {Data: compress(t, gzipEncoding, css)},
+	}
+	fileServer := FileServer(http.FS(fsys))
+
+	req := httptest.NewRequest("GET", "/app.css", nil)
+	req.Header.Set(acceptEncoding, gzipEncoding)
+	rec := httptest.NewRecorder()
+	fileServer.ServeHTTP(rec, req)
+
+	etag := rec.Header().Get("ETag")
+	assert.Cond(t, strings.HasSuffix(etag, `-gzip"`), "ETag should carry the content-coding: %s", etag)
+
+	gr, err := gzip.NewReader(rec.Body)
+	assert.Ok(t, err)
+	body, err := ioutil.ReadAll(gr)
+	assert.Ok(t, err)
+	assert.Equals(t, string(css), string(body))
+
+	req = httptest.NewRequest("GET", "/app.css", nil)
+	req.Header.Set(acceptEncoding, gzipEncoding)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	fileServer.ServeHTTP(rec, req)
+
+	assert.Equals(t, http.StatusNotModified, rec.Code)
+	assert.Equals(t, 0, rec.Body.Len())
+}
+
+func TestFileServerObserver(t *testing.T) {
+	css := []byte(strings.Repeat("body { color: red; }\n", 100))
+	gz := compress(t, gzipEncoding, css)
+	fsys := fstest.MapFS{
+		"app.css":    {Data: css},
+		"app.css.gz": {Data: gz},
+	}
+
+	var stats []Stats
+	fileServer := FileServer(http.FS(fsys), Observer(func(r *http.Request, s Stats) {
+		stats = append(stats, s)
+	}))
+
+	req := httptest.NewRequest("GET", "/app.css", nil)
+	req.Header.Set(acceptEncoding, gzipEncoding)
+	fileServer.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equals(t, []Stats{{
+		Encoding:          gzipEncoding,
+		UncompressedBytes: int64(len(css)),
+		CompressedBytes:   int64(len(gz)),
+	}}, stats)
+}
+
+func TestFileServerExclusions(t *testing.T) {
+	css := []byte(strings.Repeat("body { color: red; }\n", 100))
+	fsys := fstest.MapFS{
+		"app.css":    {Data: css},
+		"app.css.gz": {Data: compress(t, gzipEncoding, css)},
+	}
+	fileServer := FileServer(http.FS(fsys), ExcludePaths("/app"))
+
+	req := httptest.NewRequest("GET", "/app.css", nil)
+	req.Header.Set(acceptEncoding, gzipEncoding)
+	rec := httptest.NewRecorder()
+	fileServer.ServeHTTP(rec, req)
+
+	assert.Equals(t, http.StatusOK, rec.Code)
+	assert.Equals(t, "", rec.Header().Get(contentEncoding))
+	assert.Equals(t, string(css), rec.Body.String())
+}
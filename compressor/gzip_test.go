@@ -5,11 +5,16 @@
 package compressor
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/hooklift/assert"
@@ -20,7 +25,7 @@ func TestGzipHandler(t *testing.T) {
 		fmt.Fprint(w, "Hello world.")
 	})
 
-	gzipHandler := GzipHandler(requestHandler, GzipLevel(DefaultCompression))
+	gzipHandler := GzipHandler(requestHandler, GzipLevel(DefaultCompression), MinSize(0))
 	ts := httptest.NewServer(gzipHandler)
 	defer ts.Close()
 
@@ -34,8 +39,8 @@ func TestGzipHandler(t *testing.T) {
 	// Tests for vary header
 	assert.Equals(t, acceptEncoding, resp.Header.Get(vary))
 
-	assert.Equals(t, "36", resp.Header.Get(contentLength))
-	assert.Equals(t, "application/x-gzip", resp.Header.Get(contentType))
+	assert.Equals(t, strconv.Itoa(gzipLen(t, "Hello world.")), resp.Header.Get(contentLength))
+	assert.Equals(t, "text/plain; charset=utf-8", resp.Header.Get(contentType))
 
 	gr, err := gzip.NewReader(resp.Body)
 	assert.Ok(t, err)
@@ -46,3 +51,191 @@ func TestGzipHandler(t *testing.T) {
 
 	assert.Equals(t, "Hello world.", string(body))
 }
+
+// gzipLen returns the length of s once compressed using the default gzip level.
+func gzipLen(t *testing.T, s string) int {
+	var buf bytes.Buffer
+	gw, err := gzip.NewWriterLevel(&buf, DefaultCompression)
+	assert.Ok(t, err)
+	_, err = gw.Write([]byte(s))
+	assert.Ok(t, err)
+	assert.Ok(t, gw.Close())
+	return buf.Len()
+}
+
+// benchmarkBody is large enough to be compressed with the default options.
+var benchmarkBody = bytes.Repeat([]byte(`{"hello":"world"},`), 512)
+
+func BenchmarkGzipHandler(b *testing.B) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "application/json")
+		w.Write(benchmarkBody)
+	})
+	gzipHandler := GzipHandler(requestHandler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, gzipEncoding)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gzipHandler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+// BenchmarkGzipWriterNew measures allocating a new gzip.Writer per response,
+// which is what GzipHandler used to do.
+func BenchmarkGzipWriterNew(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		gw, err := gzip.NewWriterLevel(ioutil.Discard, DefaultCompression)
+		if err != nil {
+			b.Fatal(err)
+		}
+		gw.Write(benchmarkBody)
+		gw.Close()
+	}
+}
+
+// BenchmarkGzipWriterPooled measures reusing gzip.Writers from the encoder pool.
+func BenchmarkGzipWriterPooled(b *testing.B) {
+	h := &handler{
+		compressionLevel: DefaultCompression,
+		pools:            map[string]*sync.Pool{gzipEncoding: encoderPool(gzipEncoding, DefaultCompression)},
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		enc, err := h.getEncoder(gzipEncoding, ioutil.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+		enc.Write(benchmarkBody)
+		enc.Close()
+		h.putEncoder(gzipEncoding, enc)
+	}
+}
+
+func TestGzipHandlerBodilessResponses(t *testing.T) {
+	body := strings.Repeat("Hello world. ", 200)
+
+	tests := []struct {
+		name          string
+		method        string
+		status        int
+		contentLength string
+		compressed    bool
+	}{
+		{"GET drops stale Content-Length", "GET", http.StatusOK, strconv.Itoa(len(body)), true},
+		{"HEAD", "HEAD", http.StatusOK, strconv.Itoa(len(body)), false},
+		{"204 No Content", "GET", http.StatusNoContent, "", false},
+		{"304 Not Modified", "GET", http.StatusNotModified, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentLength != "" {
+					w.Header().Set(contentLength, tt.contentLength)
+				}
+				w.WriteHeader(tt.status)
+				if bodyAllowed(r.Method, tt.status) {
+					fmt.Fprint(w, body)
+				}
+			})
+
+			ts := httptest.NewServer(GzipHandler(requestHandler))
+			defer ts.Close()
+
+			req, err := http.NewRequest(tt.method, ts.URL, nil)
+			assert.Ok(t, err)
+			req.Header.Set(acceptEncoding, gzipEncoding)
+
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			assert.Ok(t, err)
+			defer resp.Body.Close()
+
+			raw, err := ioutil.ReadAll(resp.Body)
+			assert.Ok(t, err)
+
+			assert.Equals(t, tt.status, resp.StatusCode)
+			if !tt.compressed {
+				assert.Equals(t, "", resp.Header.Get(contentEncoding))
+				assert.Equals(t, tt.contentLength, resp.Header.Get(contentLength))
+				assert.Equals(t, 0, len(raw))
+				return
+			}
+
+			assert.Equals(t, gzipEncoding, resp.Header.Get(contentEncoding))
+			assert.Equals(t, strconv.Itoa(len(raw)), resp.Header.Get(contentLength))
+
+			gr, err := gzip.NewReader(bytes.NewReader(raw))
+			assert.Ok(t, err)
+			uncompressed, err := ioutil.ReadAll(gr)
+			assert.Ok(t, err)
+			assert.Equals(t, body, string(uncompressed))
+		})
+	}
+}
+
+func TestGzipHandlerFlush(t *testing.T) {
+	next := make(chan struct{})
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/event-stream")
+		flusher := w.(http.Flusher)
+
+		fmt.Fprint(w, "data: first\n\n")
+		flusher.Flush()
+
+		// The client must be able to read the first event before the second one is sent.
+		<-next
+
+		fmt.Fprint(w, "data: second\n\n")
+		flusher.Flush()
+	})
+
+	ts := httptest.NewServer(GzipHandler(requestHandler))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	assert.Ok(t, err)
+	req.Header.Set(acceptEncoding, gzipEncoding)
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	assert.Ok(t, err)
+	defer resp.Body.Close()
+
+	assert.Equals(t, gzipEncoding, resp.Header.Get(contentEncoding))
+
+	gr, err := gzip.NewReader(resp.Body)
+	assert.Ok(t, err)
+	br := bufio.NewReader(gr)
+
+	line, err := br.ReadString('\n')
+	assert.Ok(t, err)
+	assert.Equals(t, "data: first\n", line)
+
+	close(next)
+
+	rest, err := ioutil.ReadAll(br)
+	assert.Ok(t, err)
+	assert.Equals(t, "\ndata: second\n\n", string(rest))
+}
+
+func TestGzipHandlerSkipEventStream(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, gzipEncoding)
+	rec := httptest.NewRecorder()
+
+	GzipHandler(requestHandler, SkipEventStream(true)).ServeHTTP(rec, req)
+
+	assert.Equals(t, "", rec.Header().Get(contentEncoding))
+	assert.Equals(t, true, rec.Flushed)
+	assert.Equals(t, "data: first\n\n", rec.Body.String())
+}
@@ -0,0 +1,59 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package compressor
+
+import (
+	"net/http"
+	"time"
+)
+
+// SkipReason describes why a response was not compressed.
+type SkipReason string
+
+// Reasons for skipping compression reported to observers.
+const (
+	SkipNotAcceptable  SkipReason = "not_acceptable"
+	SkipEncoded        SkipReason = "already_encoded"
+	SkipExcluded       SkipReason = "excluded"
+	SkipWebSocket      SkipReason = "websocket"
+	SkipOptOut         SkipReason = "opt_out"
+	SkipNoBody         SkipReason = "no_body"
+	SkipPartialContent SkipReason = "partial_content"
+	SkipTooSmall       SkipReason = "too_small"
+	SkipContentType    SkipReason = "content_type"
+	SkipEncoderError   SkipReason = "encoder_error"
+)
+
+// Stats describes the compression of a single response.
+type Stats struct {
+	// Encoding is the content-coding used, empty if the response was not compressed.
+	Encoding string
+	// UncompressedBytes is the size of the response body written by the handler.
+	UncompressedBytes int64
+	// CompressedBytes is the size of the response body sent to the client. It is
+	// equal to UncompressedBytes when the response was not compressed.
+	CompressedBytes int64
+	// Duration is the time spent in the encoder, which includes handing its output
+	// over to the underlying http.ResponseWriter.
+	Duration time.Duration
+	// SkipReason is the reason the response was not compressed, empty otherwise.
+	SkipReason SkipReason
+}
+
+// Observer sets a function to be called with the compression stats of every response
+// once it has been served. It is meant for exporting compression ratios and costs to
+// metrics systems, so it should return quickly.
+func Observer(fn func(*http.Request, Stats)) option {
+	return func(h *handler) {
+		h.observer = fn
+	}
+}
+
+// observe reports the given stats to the observer, if there is one.
+func (h *handler) observe(r *http.Request, s Stats) {
+	if h.observer != nil {
+		h.observer(r, s)
+	}
+}
@@ -0,0 +1,80 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package compressor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+func TestObserver(t *testing.T) {
+	body := strings.Repeat("Hello world. ", 200)
+
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			fmt.Fprint(w, "Hello world.")
+		case "/png":
+			w.Header().Set(contentType, "image/png")
+			fmt.Fprint(w, body)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			fmt.Fprint(w, body)
+		}
+	})
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		encoding       string
+		uncompressed   int64
+		reason         SkipReason
+	}{
+		{"/", gzipEncoding, gzipEncoding, int64(len(body)), ""},
+		{"/", "", "", int64(len(body)), SkipNotAcceptable},
+		{"/excluded", gzipEncoding, "", int64(len(body)), SkipExcluded},
+		{"/small", gzipEncoding, "", 12, SkipTooSmall},
+		{"/png", gzipEncoding, "", int64(len(body)), SkipContentType},
+		{"/empty", gzipEncoding, "", 0, SkipNoBody},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.acceptEncoding, func(t *testing.T) {
+			var (
+				stats    Stats
+				observed int
+			)
+			observer := Observer(func(r *http.Request, s Stats) {
+				stats = s
+				observed++
+			})
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set(acceptEncoding, tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+
+			Handler(requestHandler, observer, ExcludePaths("/excluded")).ServeHTTP(rec, req)
+
+			assert.Equals(t, 1, observed)
+			assert.Equals(t, tt.encoding, stats.Encoding)
+			assert.Equals(t, tt.reason, stats.SkipReason)
+			assert.Equals(t, tt.uncompressed, stats.UncompressedBytes)
+			assert.Equals(t, int64(rec.Body.Len()), stats.CompressedBytes)
+
+			if tt.encoding != "" {
+				assert.Cond(t, stats.CompressedBytes < stats.UncompressedBytes, "compressed size should be smaller: %+v", stats)
+				assert.Cond(t, stats.Duration > 0, "compression time should be measured: %+v", stats)
+			}
+		})
+	}
+}
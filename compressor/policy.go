@@ -0,0 +1,80 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package compressor
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/c4milo/handlers/internal"
+)
+
+// SkipHeader is a marker response header handlers can set, with any value, to opt
+// out of compression for a specific response. The compressor removes it before
+// sending the response headers.
+const SkipHeader = "X-Compressor-Skip"
+
+// Exclude disables compression for requests matching the given predicate. It
+// can be used multiple times, compression is skipped if any predicate matches.
+func Exclude(fn func(*http.Request) bool) option {
+	return func(h *handler) {
+		h.excludes = append(h.excludes, fn)
+	}
+}
+
+// ExcludePaths disables compression for requests whose URL path starts with any
+// of the given prefixes. For instance, pages reflecting user input alongside
+// secrets, which are vulnerable to BREACH attacks once compressed.
+func ExcludePaths(prefixes ...string) option {
+	return Exclude(func(r *http.Request) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(r.URL.Path, p) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// ExcludeMethods disables compression for requests using any of the given methods.
+func ExcludeMethods(methods ...string) option {
+	return Exclude(func(r *http.Request) bool {
+		for _, m := range methods {
+			if strings.EqualFold(r.Method, m) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// excluded returns whether compression is disabled for the given request.
+func (h *handler) excluded(r *http.Request) bool {
+	for _, fn := range h.excludes {
+		if fn(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveUncompressed serves the request without compressing the response, making
+// sure the SkipHeader marker does not reach the client.
+func (h *handler) serveUncompressed(next http.Handler, w http.ResponseWriter, r *http.Request, reason SkipReason) {
+	rw := internal.NewResponseWriter(w)
+	rw.Before(func(w internal.ResponseWriter) {
+		w.Header().Del(SkipHeader)
+	})
+	next.ServeHTTP(rw, r)
+	// Handlers writing nothing leave the headers to be sent by net/http afterwards.
+	rw.Header().Del(SkipHeader)
+
+	size := int64(rw.Size())
+	h.observe(r, Stats{
+		UncompressedBytes: size,
+		CompressedBytes:   size,
+		SkipReason:        reason,
+	})
+}
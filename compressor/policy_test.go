@@ -0,0 +1,99 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package compressor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+func TestHandlerExclusions(t *testing.T) {
+	body := strings.Repeat("Hello world. ", 200)
+
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("skip") != "" {
+			w.Header().Set(SkipHeader, "1")
+		}
+		fmt.Fprint(w, body)
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		opts       []option
+		compressed bool
+	}{
+		{"no exclusions", "GET", "/account", nil, true},
+		{"excluded path", "GET", "/account/settings", []option{ExcludePaths("/static", "/account")}, false},
+		{"other path", "GET", "/static2", []option{ExcludePaths("/account")}, true},
+		{"excluded method", "POST", "/", []option{ExcludeMethods("post")}, false},
+		{"other method", "GET", "/", []option{ExcludeMethods("POST")}, true},
+		{"predicate", "GET", "/?secret=1", []option{Exclude(func(r *http.Request) bool {
+			return r.URL.Query().Get("secret") != ""
+		})}, false},
+		{"response opt-out", "GET", "/?skip=1", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Header.Set(acceptEncoding, gzipEncoding)
+			rec := httptest.NewRecorder()
+
+			Handler(requestHandler, tt.opts...).ServeHTTP(rec, req)
+
+			assert.Equals(t, "", rec.Header().Get(SkipHeader))
+			if tt.compressed {
+				assert.Equals(t, gzipEncoding, rec.Header().Get(contentEncoding))
+				return
+			}
+			assert.Equals(t, "", rec.Header().Get(contentEncoding))
+			assert.Equals(t, body, rec.Body.String())
+		})
+	}
+}
+
+func TestHandlerSkipHeaderNotAcceptable(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(SkipHeader, "1")
+		fmt.Fprint(w, "Hello world.")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+
+	Handler(requestHandler).ServeHTTP(rec, req)
+
+	assert.Equals(t, "", rec.Header().Get(SkipHeader))
+	assert.Equals(t, "Hello world.", rec.Body.String())
+}
+
+func TestHandlerSkipHeaderEmptyResponse(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(SkipHeader, "1")
+	})
+
+	for _, opts := range [][]option{nil, {ExcludePaths("/")}} {
+		ts := httptest.NewServer(Handler(requestHandler, opts...))
+
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		assert.Ok(t, err)
+		req.Header.Set(acceptEncoding, gzipEncoding)
+
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		assert.Ok(t, err)
+		resp.Body.Close()
+		ts.Close()
+
+		assert.Equals(t, http.StatusOK, resp.StatusCode)
+		assert.Equals(t, "", resp.Header.Get(SkipHeader))
+	}
+}
@@ -1,17 +1,27 @@
 module github.com/c4milo/handlers
 
-go 1.16
+go 1.21
 
 require (
-	github.com/frankban/quicktest v1.11.3 // indirect
-	github.com/golang/protobuf v1.4.3 // indirect
+	github.com/andybalholm/brotli v1.0.6
 	github.com/grpc-ecosystem/grpc-gateway v1.16.0
 	github.com/hooklift/assert v0.1.0
+	github.com/klauspost/compress v1.15.9
 	github.com/pierrec/lz4 v2.6.0+incompatible
 	github.com/pkg/errors v0.9.1
 	github.com/vmihailenco/msgpack v4.0.4+incompatible
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
 	golang.org/x/net v0.7.0
-	google.golang.org/genproto v0.0.0-20210315173758-2651cd453018 // indirect
 	google.golang.org/grpc v1.36.0
 )
+
+require (
+	github.com/frankban/quicktest v1.11.3 // indirect
+	github.com/golang/protobuf v1.4.3 // indirect
+	github.com/google/go-cmp v0.5.4 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+	golang.org/x/text v0.7.0 // indirect
+	google.golang.org/appengine v1.4.0 // indirect
+	google.golang.org/genproto v0.0.0-20210315173758-2651cd453018 // indirect
+	google.golang.org/protobuf v1.25.0 // indirect
+)
@@ -0,0 +1,137 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrClosed is returned when writing to a closed AsyncWriter.
+var ErrClosed = errors.New("logger: write to closed writer")
+
+// OverflowPolicy defines what AsyncWriter does with the lines written while its buffer
+// is full.
+type OverflowPolicy int
+
+const (
+	// Block waits for the buffer to have room for the line.
+	Block OverflowPolicy = iota
+	// Drop discards the line, see AsyncWriter.Dropped.
+	Drop
+)
+
+// AsyncWriter writes to an underlying writer from a background goroutine, so that logging
+// does not add the latency of the output to requests. Lines are queued in a buffer of
+// bounded size and flushed as soon as possible. It is meant to be used with Output:
+//
+//	out := logger.NewAsyncWriter(os.Stdout, 1024, logger.Drop)
+//	defer out.Close()
+//	h = logger.Handler(h, logger.Output(out))
+type AsyncWriter struct {
+	out    io.Writer
+	policy OverflowPolicy
+	lines  chan *[]byte
+	done   chan struct{}
+
+	// mu guards closing lines while Write sends to it.
+	mu      sync.RWMutex
+	closed  bool
+	err     error
+	dropped atomic.Int64
+}
+
+// NewAsyncWriter returns a new AsyncWriter writing to out, buffering up to size lines and
+// applying the given policy when the buffer is full.
+func NewAsyncWriter(out io.Writer, size int, policy OverflowPolicy) *AsyncWriter {
+	w := &AsyncWriter{
+		out:    out,
+		policy: policy,
+		lines:  make(chan *[]byte, size),
+		done:   make(chan struct{}),
+	}
+	go w.flush()
+	return w
+}
+
+// Write queues a copy of p to be written. It never fails unless the writer is closed.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return 0, ErrClosed
+	}
+
+	bp := buffers.Get().(*[]byte)
+	*bp = append((*bp)[:0], p...)
+
+	if w.policy == Drop {
+		select {
+		case w.lines <- bp:
+		default:
+			buffers.Put(bp)
+			w.dropped.Add(1)
+		}
+		return len(p), nil
+	}
+
+	w.lines <- bp
+	return len(p), nil
+}
+
+// Dropped returns the number of lines discarded so far because the buffer was full.
+func (w *AsyncWriter) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+// Close writes the lines still buffered and stops the background goroutine. It does not
+// close the underlying writer. It returns the first error the underlying writer failed
+// with, if any.
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.lines)
+	}
+	w.mu.Unlock()
+
+	<-w.done
+	return w.err
+}
+
+// flush writes the buffered lines to the underlying writer until the writer is closed.
+func (w *AsyncWriter) flush() {
+	defer close(w.done)
+
+	bw := bufio.NewWriter(w.out)
+	for bp := range w.lines {
+		// Errors are sticky and reported by Flush.
+		bw.Write(*bp)
+		if cap(*bp) <= maxPooledBuffer {
+			buffers.Put(bp)
+		}
+
+		// Flush once the queue is empty, batching writes under load.
+		if len(w.lines) == 0 {
+			w.flushBuffer(bw)
+		}
+	}
+	w.flushBuffer(bw)
+}
+
+// flushBuffer flushes bw, recording the first error and resetting bw after a failure so
+// that the following lines are still attempted.
+func (w *AsyncWriter) flushBuffer(bw *bufio.Writer) {
+	if err := bw.Flush(); err != nil {
+		if w.err == nil {
+			w.err = err
+		}
+		bw.Reset(w.out)
+	}
+}
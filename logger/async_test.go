@@ -0,0 +1,92 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+// blockingWriter blocks writes until unblock is closed.
+type blockingWriter struct {
+	bytes.Buffer
+	unblock chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.unblock
+	return w.Buffer.Write(p)
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestAsyncWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	w := NewAsyncWriter(out, 10, Block)
+
+	var expected string
+	for i := 0; i < 100; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		expected += line
+		n, err := w.Write([]byte(line))
+		assert.Ok(t, err)
+		assert.Equals(t, len(line), n)
+	}
+
+	assert.Ok(t, w.Close())
+	assert.Equals(t, expected, out.String())
+	assert.Equals(t, int64(0), w.Dropped())
+
+	_, err := w.Write([]byte("late\n"))
+	assert.Equals(t, ErrClosed, err)
+	assert.Ok(t, w.Close())
+}
+
+func TestAsyncWriterDrop(t *testing.T) {
+	out := &blockingWriter{unblock: make(chan struct{})}
+	w := NewAsyncWriter(out, 2, Drop)
+
+	for i := 0; i < 10; i++ {
+		_, err := w.Write([]byte("line\n"))
+		assert.Ok(t, err)
+	}
+
+	dropped := w.Dropped()
+	assert.Cond(t, dropped > 0, "lines should be dropped while the output is blocked")
+
+	close(out.unblock)
+	assert.Ok(t, w.Close())
+	assert.Equals(t, int(10-dropped), strings.Count(out.String(), "line\n"))
+}
+
+func TestAsyncWriterError(t *testing.T) {
+	w := NewAsyncWriter(failingWriter{}, 10, Block)
+	w.Write([]byte("line\n"))
+	assert.Equals(t, "disk full", w.Close().Error())
+}
+
+func TestHandlerAsyncOutput(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	out := new(bytes.Buffer)
+	w := NewAsyncWriter(out, 10, Block)
+	logHandler := Handler(requestHandler, Output(w), Format("{method} {url}"), Flags(0))
+	logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Ok(t, w.Close())
+	assert.Equals(t, "[unknown_app] GET /\n[unknown_app] GET /\n", out.String())
+}
@@ -0,0 +1,73 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// body counts the bytes read from a request body. Counters are atomic since requests
+// still running are logged from a different goroutine, see StillRunning.
+type body struct {
+	io.ReadCloser
+	// size is the length of the body announced by the client, -1 if unknown.
+	size int64
+	read atomic.Int64
+	eof  atomic.Bool
+}
+
+// countBody replaces the body of the request with one counting the bytes read from it.
+// It returns nil if the request has no body.
+func countBody(r *http.Request) *body {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	b := &body{ReadCloser: r.Body, size: r.ContentLength}
+	r.Body = b
+	return b
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read.Add(int64(n))
+	if err == io.EOF {
+		b.eof.Store(true)
+	}
+	return n, err
+}
+
+// rxbytes returns the value of the {rxbytes} directive: the bytes read from the body.
+func rxbytes(e *entry) value {
+	if e.latency < 0 {
+		return value{}
+	}
+	if e.body == nil {
+		return intValue(0)
+	}
+	return intValue(e.body.read.Load())
+}
+
+// rxbytesUnread returns the value of the {rxbytes_unread} directive: the bytes left in the
+// body, unknown if the body was not read until the end and its length was not announced.
+func rxbytesUnread(e *entry) value {
+	if e.latency < 0 {
+		return value{}
+	}
+	if e.body == nil || e.body.eof.Load() {
+		return intValue(0)
+	}
+	if e.body.size < 0 {
+		return value{}
+	}
+
+	unread := e.body.size - e.body.read.Load()
+	if unread < 0 {
+		unread = 0
+	}
+	return intValue(unread)
+}
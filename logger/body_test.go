@@ -0,0 +1,61 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+func TestHandlerRxBytes(t *testing.T) {
+	payload := strings.Repeat("a", 100)
+
+	tests := []struct {
+		name     string
+		body     io.Reader
+		size     int64
+		read     int64
+		expected string
+	}{
+		{"no body", nil, 0, 0, "0 0"},
+		{"read all", strings.NewReader(payload), 100, -1, "100 0"},
+		{"ignored", strings.NewReader(payload), 100, 0, "0 100"},
+		{"partially read", strings.NewReader(payload), 100, 40, "40 60"},
+		{"chunked read all", strings.NewReader(payload), -1, -1, "100 0"},
+		{"chunked partially read", strings.NewReader(payload), -1, 40, "40 ..."},
+		{"understated length", strings.NewReader(payload), 10, -1, "100 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.read < 0 {
+					ioutil.ReadAll(r.Body)
+					return
+				}
+				io.CopyN(ioutil.Discard, r.Body, tt.read)
+			})
+
+			logging := new(bytes.Buffer)
+			logHandler := Handler(requestHandler, Output(logging), Format("{rxbytes} {rxbytes_unread}"), Flags(0))
+
+			req := httptest.NewRequest("POST", "/", tt.body)
+			req.ContentLength = tt.size
+			logHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+			lines := strings.Split(strings.TrimSpace(logging.String()), "\n")
+			assert.Equals(t, 2, len(lines))
+			assert.Equals(t, "[unknown_app] ... ...", lines[0])
+			assert.Equals(t, "[unknown_app] "+tt.expected, lines[1])
+		})
+	}
+}
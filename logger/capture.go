@@ -0,0 +1,215 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/c4milo/handlers/internal"
+)
+
+// defaultRedactedFields are the JSON fields masked by default in captured bodies.
+var defaultRedactedFields = []string{
+	"password",
+	"secret",
+	"token",
+	"access_token",
+	"refresh_token",
+	"client_secret",
+}
+
+// CaptureBodies enables capturing up to limit bytes of the request and response bodies of
+// the requests for which match returns true, or of every request if match is nil. It is
+// meant for debugging client integrations, match allowing to select requests by path,
+// header or sampling.
+//
+// Bodies are captured as they are read by the handler and written to the client, so
+// the request body is not consumed for the handler, and never more than limit bytes are
+// kept. They are logged as the req_body and res_body fields, see Fields, along with
+// req_body_truncated and res_body_truncated set to true if there was more than limit
+// bytes. Fields of JSON bodies are masked, whatever their Content-Type, see RedactFields.
+func CaptureBodies(limit int, match func(*http.Request) bool) Option {
+	return func(l *handler) {
+		l.captureLimit = limit
+		l.captureMatch = match
+	}
+}
+
+// RedactFields sets the JSON fields whose values are masked in captured bodies, replacing
+// the default list: password, secret, token, access_token, refresh_token and
+// client_secret. Field names are matched case-insensitively, at any depth.
+func RedactFields(names ...string) Option {
+	return func(l *handler) {
+		l.redactFields = lowercaseSet(names)
+	}
+}
+
+// lowercaseSet returns a set with the lowercase form of the given names.
+func lowercaseSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[strings.ToLower(n)] = true
+	}
+	return set
+}
+
+// capture holds up to limit bytes of a body.
+type capture struct {
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+// write captures p, up to the limit.
+func (c *capture) write(p []byte) {
+	if room := c.limit - len(c.buf); len(p) > room {
+		p = p[:room]
+		c.truncated = true
+	}
+	c.buf = append(c.buf, p...)
+}
+
+// captureReader captures a request body as it is read.
+type captureReader struct {
+	io.ReadCloser
+	capture *capture
+}
+
+func (r *captureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.capture.write(p[:n])
+	return n, err
+}
+
+// captureWriter captures a response body as it is written.
+type captureWriter struct {
+	internal.ResponseWriter
+	capture *capture
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.capture.write(p[:n])
+	return n, err
+}
+
+// captureBodies sets up the capture of the bodies of the request, if enabled for it. It
+// returns the response writer to serve the request with and a function logging the
+// captured bodies into the given fields.
+func (l *handler) captureBodies(w internal.ResponseWriter, r *http.Request, fields *Fields) (internal.ResponseWriter, func()) {
+	if l.captureLimit <= 0 || (l.captureMatch != nil && !l.captureMatch(r)) {
+		return w, func() {}
+	}
+
+	req, res := &capture{limit: l.captureLimit}, &capture{limit: l.captureLimit}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &captureReader{r.Body, req}
+	}
+
+	return &captureWriter{w, res}, func() {
+		l.setCaptured(fields, "req_body", req)
+		l.setCaptured(fields, "res_body", res)
+	}
+}
+
+// setCaptured sets the fields of a captured body, masking the redacted fields. Bodies are
+// redacted regardless of their Content-Type, which handlers may not set, since redacting
+// bodies other than JSON leaves them untouched.
+func (l *handler) setCaptured(fields *Fields, name string, c *capture) {
+	fields.Set(name, string(redactJSON(c.buf, l.redactFields)))
+	if c.truncated {
+		fields.Set(name+"_truncated", true)
+	}
+}
+
+// redactJSON returns a copy of data with the values of the given object members replaced
+// by a mask. It does not validate data, which may be truncated.
+func redactJSON(data []byte, names map[string]bool) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		if data[i] != '"' {
+			out = append(out, data[i])
+			i++
+			continue
+		}
+
+		end := skipJSONString(data, i)
+		key := data[i:end]
+		out = append(out, key...)
+		i = end
+
+		// Only strings followed by a colon are member names.
+		j := skipJSONSpace(data, i)
+		if j == len(data) || data[j] != ':' || len(key) < 2 || !names[strings.ToLower(string(key[1:len(key)-1]))] {
+			continue
+		}
+
+		k := skipJSONSpace(data, j+1)
+		out = append(out, data[i:k]...)
+		out = append(out, `"`+redacted+`"`...)
+		i = skipJSONValue(data, k)
+	}
+	return out
+}
+
+// skipJSONSpace returns the index of the first non-whitespace byte of data from i.
+func skipJSONSpace(data []byte, i int) int {
+	for i < len(data) && strings.IndexByte(" \t\r\n", data[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// skipJSONString returns the index following the string starting at i, or the length of
+// data if it is not terminated.
+func skipJSONString(data []byte, i int) int {
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return len(data)
+}
+
+// skipJSONValue returns the index following the value starting at i, or the length of
+// data if it is not terminated.
+func skipJSONValue(data []byte, i int) int {
+	if i == len(data) {
+		return i
+	}
+
+	switch data[i] {
+	case '"':
+		return skipJSONString(data, i)
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(data); j++ {
+			switch data[j] {
+			case '"':
+				j = skipJSONString(data, j) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return j + 1
+				}
+			}
+		}
+		return len(data)
+	}
+
+	for j := i; j < len(data); j++ {
+		if strings.IndexByte(",}] \t\r\n", data[j]) >= 0 {
+			return j
+		}
+	}
+	return len(data)
+}
@@ -0,0 +1,119 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+func TestRedactJSON(t *testing.T) {
+	names := lowercaseSet([]string{"password", "token"})
+
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{`{"user":"bob","password":"s3cr3t"}`, `{"user":"bob","password":"[REDACTED]"}`},
+		{`{"Password" : 1234, "n": 1}`, `{"Password" : "[REDACTED]", "n": 1}`},
+		{`{"token":{"a":"}","b":[1,2]},"n":1}`, `{"token":"[REDACTED]","n":1}`},
+		{`[{"auth":{"token":null}}]`, `[{"auth":{"token":"[REDACTED]"}}]`},
+		{`{"note":"password","x":"a\"password\":1"}`, `{"note":"password","x":"a\"password\":1"}`},
+		{`{"user":"bob","password":"s3c`, `{"user":"bob","password":"[REDACTED]"`},
+		{`{"token":{"a":1,`, `{"token":"[REDACTED]"`},
+		{`{"pass`, `{"pass`},
+		{`not json`, `not json`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			assert.Equals(t, tt.expected, string(redactJSON([]byte(tt.data), names)))
+		})
+	}
+}
+
+func TestHandlerCaptureBodies(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"echo":`))
+		w.Write(body)
+		w.Write([]byte(`,"token":"abcdef"}`))
+	})
+
+	payload := `{"user":"bob","password":"s3cr3t"}`
+
+	tests := []struct {
+		name     string
+		limit    int
+		match    func(*http.Request) bool
+		captured bool
+		reqBody  string
+		resBody  string
+		resTrunc bool
+	}{
+		{"all", 1024, nil, true, `{"user":"bob","password":"[REDACTED]"}`,
+			`{"echo":{"user":"bob","password":"[REDACTED]"},"token":"[REDACTED]"}`, false},
+		{"truncated", 20, nil, true, `{"user":"bob","passw`, `{"echo":{"user":"bob`, true},
+		{"not matching", 1024, func(r *http.Request) bool { return r.URL.Path == "/debug" }, false, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logging := new(bytes.Buffer)
+			logHandler := Handler(requestHandler, Output(logging), Format("{status}"), JSON(true), StartLine(false),
+				CaptureBodies(tt.limit, tt.match))
+
+			req := httptest.NewRequest("POST", "/", strings.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			logHandler.ServeHTTP(rec, req)
+
+			// The handler still gets the whole body.
+			assert.Equals(t, `{"echo":`+payload+`,"token":"abcdef"}`, rec.Body.String())
+
+			var entry map[string]interface{}
+			assert.Ok(t, json.Unmarshal(logging.Bytes(), &entry))
+			if !tt.captured {
+				_, ok := entry["req_body"]
+				assert.Equals(t, false, ok)
+				return
+			}
+
+			assert.Equals(t, tt.reqBody, entry["req_body"])
+			assert.Equals(t, tt.resBody, entry["res_body"])
+			assert.Equals(t, tt.limit < len(payload), entry["req_body_truncated"] != nil)
+			assert.Equals(t, tt.resTrunc, entry["res_body_truncated"] != nil)
+		})
+	}
+}
+
+func TestHandlerCaptureBodiesNoContentType(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"access_token":"SECRET123","expires_in":3600}`))
+	})
+
+	logging := new(syncBuffer)
+	ts := httptest.NewServer(Handler(requestHandler, Output(logging), Format("{status}"), JSON(true), StartLine(false),
+		CaptureBodies(1024, nil)))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "", strings.NewReader(`{"client_secret":"SECRET456"}`))
+	assert.Ok(t, err)
+	resp.Body.Close()
+
+	var entry map[string]interface{}
+	assert.Ok(t, json.Unmarshal([]byte(logging.String()), &entry))
+	assert.Equals(t, `{"client_secret":"[REDACTED]"}`, entry["req_body"])
+	assert.Equals(t, `{"access_token":"[REDACTED]","expires_in":3600}`, entry["res_body"])
+}
@@ -0,0 +1,120 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// redacted is logged in place of the values of redacted headers.
+const redacted = "[REDACTED]"
+
+// defaultRedactedHeaders are the headers masked by default since they carry credentials.
+var defaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// ContextValue registers an extractor function for the {ctx:key} directive. It is called with
+// the request's context and its return value is logged. It allows logging values such as
+// tenant or trace IDs stored in the context by other handlers.
+func ContextValue(key string, fn func(context.Context) interface{}) Option {
+	return func(l *handler) {
+		if l.extractors == nil {
+			l.extractors = make(map[string]func(context.Context) interface{})
+		}
+		l.extractors[key] = fn
+	}
+}
+
+// Redact sets the list of headers whose values are masked when logged through the
+// {header:Name}, {req_header:Name} or {res_header:Name} directives, replacing the default
+// list: Authorization, Proxy-Authorization, Cookie and Set-Cookie. The values logged
+// through {cookie:name} are masked if the Cookie header is in the list, or the name of
+// the cookie, so that only cookies not carrying credentials can be logged:
+//
+//	Redact("Authorization", "Proxy-Authorization", "Set-Cookie", "session")
+//
+// Values of directives with an argument are controlled by the client, so their control
+// characters, quotes and backslashes are escaped with a backslash in text mode.
+func Redact(headers ...string) Option {
+	return func(l *handler) {
+		l.redact = canonicalHeaders(headers)
+	}
+}
+
+// canonicalHeaders returns a set with the canonical form of the given header names.
+func canonicalHeaders(headers []string) map[string]bool {
+	set := make(map[string]bool, len(headers))
+	for _, h := range headers {
+		set[http.CanonicalHeaderKey(h)] = true
+	}
+	return set
+}
+
+// dynamicField returns the function computing the value of a directive with an argument,
+// such as {cookie:name}. It returns false if the directive is not one of them.
+func (l *handler) dynamicField(directive string) (func(*entry) value, bool) {
+	i := strings.IndexByte(directive, ':')
+	if i < 0 {
+		return nil, false
+	}
+
+	kind, arg := directive[:i], directive[i+1:]
+	switch kind {
+	case "header", "req_header":
+		name, redact := http.CanonicalHeaderKey(arg), l.redact[http.CanonicalHeaderKey(arg)]
+		return func(e *entry) value {
+			return stringValue(headerValue(e.r.Header, name, redact))
+		}, true
+	case "res_header":
+		name, redact := http.CanonicalHeaderKey(arg), l.redact[http.CanonicalHeaderKey(arg)]
+		return func(e *entry) value {
+			return stringValue(headerValue(e.w.Header(), name, redact))
+		}, true
+	case "cookie":
+		redact := l.redact["Cookie"] || l.redact[http.CanonicalHeaderKey(arg)]
+		return func(e *entry) value {
+			c, err := e.r.Cookie(arg)
+			if err != nil || c.Value == "" {
+				return stringValue("")
+			}
+			if redact {
+				return stringValue(redacted)
+			}
+			return stringValue(c.Value)
+		}, true
+	case "query_param":
+		return func(e *entry) value {
+			return stringValue(e.r.URL.Query().Get(arg))
+		}, true
+	case "ctx":
+		fn, ok := l.extractors[arg]
+		if !ok {
+			return func(*entry) value { return stringValue("") }, true
+		}
+		return func(e *entry) value {
+			return anyValue(fn(e.r.Context()))
+		}, true
+	}
+	return nil, false
+}
+
+// headerValue returns the value of the header with the given canonical name, masked if
+// redact is true.
+func headerValue(headers http.Header, name string, redact bool) string {
+	v := headers[name]
+	if len(v) == 0 {
+		return ""
+	}
+	if redact && v[0] != "" {
+		return redacted
+	}
+	return v[0]
+}
@@ -0,0 +1,71 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+type tenantKey struct{}
+
+func TestHandlerDynamicDirectives(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Secret", "s3cr3t")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tenantHandler := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, "acme")))
+		})
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		opts     []Option
+		expected string
+	}{
+		{"request header", "{req_header:X-Foo} {header:x-foo}", nil, "bar bar"},
+		{"response header", "{res_header:Cache-Control}", nil, "no-store"},
+		{"cookie", "{cookie:theme} {cookie:missing}", []Option{Redact("Authorization", "session")}, "dark "},
+		{"query param", "{query_param:q}", nil, "golang"},
+		{"hostile query param", "{query_param:evil}", nil, `a\n[unknown_app] \"forged\"`},
+		{"context value", "{ctx:tenant} {ctx:unknown}", []Option{ContextValue("tenant", func(ctx context.Context) interface{} {
+			return ctx.Value(tenantKey{})
+		})}, "acme "},
+		{"default redaction", "{req_header:Authorization} {req_header:Cookie}", nil, "[REDACTED] [REDACTED]"},
+		{"cookie redaction", "{cookie:session} {cookie:theme}", nil, "[REDACTED] [REDACTED]"},
+		{"cookie name redaction", "{cookie:session} {cookie:theme}", []Option{Redact("Authorization", "session")}, "[REDACTED] dark"},
+		{"custom redaction", "{req_header:Authorization} {res_header:x-secret}", []Option{Redact("X-Secret")}, "Bearer token [REDACTED]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logging := new(bytes.Buffer)
+			opts := append([]Option{Output(logging), Format(tt.format), Flags(0), AppName("test")}, tt.opts...)
+			logHandler := tenantHandler(Handler(requestHandler, opts...))
+
+			req := httptest.NewRequest("GET", "/?q=golang&evil=a%0A[unknown_app]%20%22forged%22", nil)
+			req.Header.Set("X-Foo", "bar")
+			req.Header.Set("Authorization", "Bearer token")
+			req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+			req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+			logHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+			lines := strings.Split(logging.String(), "\n")
+			assert.Equals(t, 3, len(lines))
+			assert.Equals(t, "[test] "+tt.expected, lines[1])
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"unicode"
+)
+
+// Fields is a request-scoped bag of fields added to the log line of the request once it
+// has been served. Handlers get it from the request's context, see FromContext, to log
+// values only they know about, such as the user ID or whether the response was cached.
+// It is safe for concurrent use.
+type Fields struct {
+	mu     sync.Mutex
+	keys   []string
+	values map[string]interface{}
+	// id is the request ID, logger the structured logger configured through Slog, if any.
+	id     string
+	logger *slog.Logger
+	// traceID and spanID identify the request's span, if traced.
+	traceID string
+	spanID  string
+}
+
+// Set sets the value of a field. Fields are logged in the order they were first set:
+// text lines end with key=value pairs, keys and values being quoted if needed, JSON lines
+// and structured records get them as additional fields. In JSON lines and structured
+// records, keys colliding with the ones logged by the handler, such as "status", "time"
+// or "app", are prefixed with "fields." so that no key is logged twice. Fields are not
+// logged with Preset, whose lines have a fixed layout.
+func (f *Fields) Set(key string, value interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.values == nil {
+		f.values = make(map[string]interface{})
+	}
+	if _, ok := f.values[key]; !ok {
+		f.keys = append(f.keys, key)
+	}
+	f.values[key] = value
+}
+
+// Get returns the value of a field, nil if it is not set.
+func (f *Fields) Get(key string) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.values[key]
+}
+
+// Logger returns a structured logger to log from handlers with the request ID, as well as
+// the trace and span IDs if the request is traced, see package tracing. It is the logger
+// configured through Slog, or slog's default logger otherwise.
+func (f *Fields) Logger() *slog.Logger {
+	logger := f.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	var attrs []interface{}
+	if f.id != "" {
+		attrs = append(attrs, slog.String("id", f.id))
+	}
+	if f.traceID != "" {
+		attrs = append(attrs, slog.String("trace_id", f.traceID), slog.String("span_id", f.spanID))
+	}
+	if len(attrs) == 0 {
+		return logger
+	}
+	return logger.With(attrs...)
+}
+
+// appendText appends the fields to a text log line.
+func (f *Fields) appendText(buf []byte) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range f.keys {
+		buf = append(buf, ' ')
+		if needsQuoting(k) {
+			buf = strconv.AppendQuote(buf, k)
+		} else {
+			buf = append(buf, k...)
+		}
+		buf = append(buf, '=')
+
+		v := anyValue(f.values[k])
+		if v.kind == kindInt {
+			buf = v.appendText(buf, "")
+			continue
+		}
+
+		s := string(v.appendText(nil, ""))
+		if needsQuoting(s) {
+			buf = strconv.AppendQuote(buf, s)
+			continue
+		}
+		buf = append(buf, s...)
+	}
+	return buf
+}
+
+// needsQuoting returns whether s has to be quoted to be logged as the value of a field.
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r == ' ' || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendJSON appends the fields to the members of a JSON object, prefixing the keys in
+// the reserved set.
+func (f *Fields) appendJSON(buf []byte, reserved map[string]bool) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range f.keys {
+		buf = append(buf, ',')
+		buf = appendJSONString(buf, fieldKey(k, reserved))
+		buf = append(buf, ':')
+		v := anyValue(f.values[k])
+		if v.kind == kindUnknown {
+			buf = append(buf, "null"...)
+			continue
+		}
+		buf = v.appendJSON(buf)
+	}
+	return buf
+}
+
+// appendAttrs appends the fields to the attributes of a structured record, prefixing the
+// keys in the reserved set.
+func (f *Fields) appendAttrs(attrs []slog.Attr, reserved map[string]bool) []slog.Attr {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range f.keys {
+		attrs = append(attrs, anyValue(f.values[k]).attr(fieldKey(k, reserved)))
+	}
+	return attrs
+}
+
+// fieldKey returns the key a field is logged with in JSON lines and structured records.
+func fieldKey(key string, reserved map[string]bool) string {
+	if reserved[key] {
+		return "fields." + key
+	}
+	return key
+}
+
+// fieldsKey is the key used to store the fields of the request in its context.
+type fieldsKey struct{}
+
+// newContext returns a new context carrying the given fields.
+func newContext(ctx context.Context, f *Fields) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, f)
+}
+
+// FromContext extracts the fields of the request from the given context.
+func FromContext(ctx context.Context) (f *Fields, ok bool) {
+	f, ok = ctx.Value(fieldsKey{}).(*Fields)
+	return
+}
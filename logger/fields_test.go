@@ -0,0 +1,138 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c4milo/handlers/requestid"
+	"github.com/hooklift/assert"
+)
+
+// fieldsHandler sets fields on the request's log line.
+var fieldsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	fields, ok := FromContext(r.Context())
+	if !ok {
+		panic("fields not found in the request's context")
+	}
+	fields.Set("user_id", 42)
+	fields.Set("cache", "miss")
+	fields.Set("note", `two words`)
+	fields.Set("cache", "hit")
+})
+
+func TestHandlerFields(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logHandler := Handler(fieldsHandler, Output(logging), Format("{status}"), Flags(0))
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		lines := strings.Split(strings.TrimSpace(logging.String()), "\n")
+		assert.Equals(t, 2, len(lines))
+		assert.Equals(t, "[unknown_app] ...", lines[0])
+		assert.Equals(t, `[unknown_app] 0 user_id=42 cache=hit note="two words"`, lines[1])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logHandler := Handler(fieldsHandler, Output(logging), Format("{status}"), JSON(true), StartLine(false))
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		var entry map[string]interface{}
+		assert.Ok(t, json.Unmarshal(logging.Bytes(), &entry))
+		assert.Equals(t, float64(42), entry["user_id"])
+		assert.Equals(t, "hit", entry["cache"])
+		assert.Equals(t, "two words", entry["note"])
+	})
+
+	t.Run("slog", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logger := slog.New(slog.NewJSONHandler(logging, nil))
+		logHandler := Handler(fieldsHandler, Slog(logger))
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		var record map[string]interface{}
+		assert.Ok(t, json.Unmarshal(logging.Bytes(), &record))
+		assert.Equals(t, float64(42), record["user_id"])
+		assert.Equals(t, "hit", record["cache"])
+	})
+}
+
+func TestFieldsLogger(t *testing.T) {
+	logging := new(bytes.Buffer)
+	logger := slog.New(slog.NewJSONHandler(logging, nil))
+
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields, _ := FromContext(r.Context())
+		fields.Logger().Info("cache warmed")
+	})
+	logHandler := requestid.Handler(Handler(requestHandler, Slog(logger)), requestid.WithGenerator(func() string { return "abc" }))
+	logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var record map[string]interface{}
+	line := strings.Split(logging.String(), "\n")[0]
+	assert.Ok(t, json.Unmarshal([]byte(line), &record))
+	assert.Equals(t, "cache warmed", record["msg"])
+	assert.Equals(t, "abc", record["id"])
+}
+
+func TestHandlerFieldsKeys(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields, _ := FromContext(r.Context())
+		fields.Set("user id", "a b")
+		fields.Set("status", "active")
+		fields.Set("app", "billing")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logHandler := Handler(requestHandler, Output(logging), Format("{status}"), Flags(0), StartLine(false))
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		assert.Equals(t, "[unknown_app] 200 \"user id\"=\"a b\" status=active app=billing\n", logging.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logHandler := Handler(requestHandler, Output(logging), Format("{status}"), JSON(true), StartLine(false))
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		assert.Equals(t, 1, strings.Count(logging.String(), `"status":`))
+		var entry map[string]interface{}
+		assert.Ok(t, json.Unmarshal(logging.Bytes(), &entry))
+		assert.Equals(t, float64(http.StatusOK), entry["status"])
+		assert.Equals(t, "active", entry["fields.status"])
+		assert.Equals(t, "unknown_app", entry["app"])
+		assert.Equals(t, "billing", entry["fields.app"])
+		assert.Equals(t, "a b", entry["user id"])
+	})
+
+	t.Run("slog", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logger := slog.New(slog.NewJSONHandler(logging, nil))
+		logHandler := Handler(requestHandler, Format("{status}"), Slog(logger))
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		var record map[string]interface{}
+		assert.Ok(t, json.Unmarshal(logging.Bytes(), &record))
+		assert.Equals(t, float64(http.StatusOK), record["status"])
+		assert.Equals(t, "active", record["fields.status"])
+	})
+
+	t.Run("preset", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logHandler := Handler(requestHandler, Output(logging), Preset(CommonLogFormat))
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		assert.Cond(t, strings.HasSuffix(logging.String(), `"GET / HTTP/1.1" 200 -`+"\n"), "unexpected log line: %q", logging.String())
+	})
+}
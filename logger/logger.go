@@ -6,19 +6,28 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
-	"strconv"
-	"strings"
 	"time"
 
+	"github.com/c4milo/handlers/clientip"
 	"github.com/c4milo/handlers/internal"
+	"github.com/c4milo/handlers/requestid"
+	"github.com/c4milo/handlers/tracing"
 )
 
+// clfTimeLayout is the time layout used by the Common Log Format.
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// defaultFormat is the log format used unless Format or Preset are given.
+const defaultFormat = `{id} remote_ip={remote_ip} user-agent={useragent} {method} "{scheme}{host}{url}?{query}" status={status} latency_human={latency_human} latency={latency} rxbytes={rxbytes} txbytes={txbytes}`
+
 // Option implements http://commandcenter.blogspot.com/2014/01/self-referential-functions-and-design.html
 type Option func(*handler)
 
@@ -28,6 +37,42 @@ type handler struct {
 	format string
 	flags  int
 	out    io.Writer
+	json   bool
+	slog   *slog.Logger
+	// empty is logged in place of empty values in text mode.
+	empty string
+	// bare disables the application name prefix in text mode.
+	bare bool
+	// preset is set by Preset, whose lines have a fixed layout.
+	preset bool
+	// escape escapes string values in text mode, see Preset.
+	escape func(buf []byte, s string) []byte
+	// dashZeroBytes logs the empty placeholder in place of a zero {txbytes} in text mode.
+	dashZeroBytes bool
+	// skipStart disables the line logged before serving the request.
+	skipStart bool
+	// redact holds the canonical names of the headers whose values are masked.
+	redact map[string]bool
+	// extractors hold the functions returning the values of {ctx:key} directives.
+	extractors map[string]func(context.Context) interface{}
+	// template is the log format, compiled once all options are applied.
+	template *template
+	// rate is the fraction of the requests logged, see Sample.
+	rate float64
+	// slowThreshold is the latency from which requests are considered slow.
+	slowThreshold time.Duration
+	// slowPaths hold the slow thresholds by path prefix.
+	slowPaths map[string]time.Duration
+	// stillRunning enables logging requests reaching their slow threshold.
+	stillRunning bool
+	// recover enables recovering from panics, see Recover.
+	recover   bool
+	errorPage func(http.ResponseWriter, *http.Request, interface{})
+	// captureLimit is the number of bytes of the bodies captured, see CaptureBodies.
+	captureLimit int
+	captureMatch func(*http.Request) bool
+	// redactFields holds the lowercase names of the JSON fields masked in captured bodies.
+	redactFields map[string]bool
 }
 
 // AppName allows to set the application name to log.
@@ -43,20 +88,36 @@ func AppName(name string) Option {
 // Directives:
 //
 // {remote_user}		: Remote user if Basic Auth credentials were sent
-// {remote_ip}			: Remote IP address.
+// {remote_ip}			: Remote IP address, the client IP if resolved by package clientip.
 // {latency}			: The time taken to serve the request, in microseconds.
 // {latency_human}		: The time taken to serve the request, human readable.
-// {id}					: The request ID.
+// {id}					: The request ID, see package requestid.
+// {trace_id}			: The trace ID of the request, see package tracing.
+// {span_id}			: The ID of the request's span, see package tracing.
 // {host}				: The Host header sent to the server
 // {scheme}             : The protocol scheme used, either http or https.
 // {method}				: The request method. Ex: GET, POST, DELETE, etc.
 // {url}				: The URL path requested.
 // {query}				: Request's query string
-// {rxbytes}			: Bytes received without headers
+// {rxbytes}			: Bytes of the request body read by the handler
+// {rxbytes_unread}		: Bytes of the request body left unread by the handler, if known
 // {txbytes}			: Bytes sent, excluding HTTP headers.
 // {status}				: Status sent to the client
 // {useragent}			: User Agent
 // {referer}			: The site from where the request came from
+// {proto}				: The request protocol. Ex: HTTP/1.1
+// {uri}				: The request URI, including the query string
+// {time_local}			: The time the request was received, in Common Log Format
+// {utc_date}			: The date the request was received, in UTC. Ex: 2006-01-02
+// {utc_time}			: The time the request was received, in UTC. Ex: 15:04:05
+// {header:Name}		: The value of the request header Name
+// {req_header:Name}	: The value of the request header Name, same as {header:Name}
+// {res_header:Name}	: The value of the response header Name
+// {cookie:name}		: The value of the request cookie name
+// {query_param:name}	: The value of the query string parameter name
+// {ctx:key}			: The value returned by the extractor registered for key, see ContextValue
+//
+// Values of the headers in the redaction list are masked, see Redact.
 //
 func Format(format string) Option {
 	return func(l *handler) {
@@ -81,113 +142,231 @@ func Output(out io.Writer) Option {
 	}
 }
 
+// JSON enables structured logging. Each line is a JSON object with the time, in RFC 3339
+// format with nanoseconds, the application name and the values of the directives used in
+// the log format, keyed by directive name. Numeric values such as status, latency, rxbytes
+// and txbytes are logged as numbers. Flags are ignored in this mode.
+func JSON(enabled bool) Option {
+	return func(l *handler) {
+		l.json = enabled
+	}
+}
+
+// Preset log formats, see Preset.
+const (
+	// CommonLogFormat is the NCSA Common Log Format.
+	CommonLogFormat = `{remote_ip} - {remote_user} [{time_local}] "{method} {uri} {proto}" {status} {txbytes}`
+	// CombinedLogFormat is the Apache Combined Log Format.
+	CombinedLogFormat = CommonLogFormat + ` "{header:Referer}" "{header:User-Agent}"`
+	// W3CExtendedLogFormat is the W3C Extended Log File Format with the following fields:
+	// date time c-ip cs-username cs-method cs-uri-stem cs-uri-query sc-status sc-bytes cs(User-Agent) cs(Referer)
+	W3CExtendedLogFormat = `{utc_date} {utc_time} {remote_ip} {remote_user} {method} {url} {query} {status} {txbytes} {header:User-Agent} {header:Referer}`
+)
+
+// Preset configures one of the preset log formats: CommonLogFormat, CombinedLogFormat or
+// W3CExtendedLogFormat. Unlike Format, it also disables the application name prefix, the
+// timestamp flags and the line logged before serving the request, as well as the one
+// logged for requests still running, see StillRunning, and logs "-" in place of empty
+// values, so that lines can be consumed by tools such as goaccess or awstats. For the
+// same reason, lines hold nothing but the preset's fields: the fields set by handlers,
+// captured bodies and the slow and panic markers are left out, see JSON or Slog to log
+// them.
+//
+// Values are escaped so that they cannot break the layout of the lines: W3C Extended
+// fields get their spaces replaced with "+", while the other formats escape quotes and
+// backslashes with a backslash, as Apache does, and log "-" when no body was sent.
+func Preset(format string) Option {
+	return func(l *handler) {
+		l.format = format
+		l.flags = 0
+		l.empty = "-"
+		l.bare = true
+		l.skipStart = true
+		l.preset = true
+
+		if format == W3CExtendedLogFormat {
+			l.escape = appendW3CEscaped
+			return
+		}
+		l.escape = appendCLFEscaped
+		l.dashZeroBytes = true
+	}
+}
+
 // Handler does HTTP request logging
 func Handler(h http.Handler, opts ...Option) http.Handler {
 	// Default options
 	handler := &handler{
-		name:   "unknown_app",
-		format: `{id} remote_ip={remote_ip} user-agent={useragent} {method} "{scheme}{host}{url}?{query}" status={status} latency_human={latency_human} latency={latency} rxbytes={rxbytes} txbytes={txbytes}`,
-		out:    os.Stdout,
-		flags:  log.LstdFlags | log.Lmicroseconds,
+		name:         "unknown_app",
+		format:       defaultFormat,
+		out:          os.Stdout,
+		flags:        log.LstdFlags | log.Lmicroseconds,
+		redact:       canonicalHeaders(defaultRedactedHeaders),
+		redactFields: lowercaseSet(defaultRedactedFields),
+		rate:         1,
 	}
 
 	for _, opt := range opts {
 		opt(handler)
 	}
+	handler.template = handler.compile(handler.format)
 
 	l := log.New(handler.out, fmt.Sprintf("[%s] ", handler.name), handler.flags)
+	if handler.json {
+		l = log.New(handler.out, "", 0)
+	} else if handler.bare {
+		l = log.New(handler.out, "", handler.flags)
+	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		sampled := handler.sampled(w, r)
+		threshold := handler.threshold(r)
 
-		l.Print(applyLogFormat(handler.format, -1, w, r))
+		if sampled && !handler.skipStart {
+			handler.log(l, &entry{start: start, latency: -1, w: w, r: r})
+		}
+
+		body := countBody(r)
+		fields := &Fields{id: requestID(w, r), logger: handler.slog, traceID: traceID(r), spanID: spanID(r)}
+		r = r.WithContext(newContext(r.Context(), fields))
+
+		if handler.stillRunning && !handler.preset && threshold > 0 {
+			// The request is cloned since handlers may modify it while it is logged.
+			pending := &entry{start: start, w: pendingResponse{make(http.Header)}, r: r.Clone(r.Context()), body: body, fields: fields, marker: runningMarker}
+			timer := time.AfterFunc(threshold, func() {
+				pending.latency = time.Since(start)
+				handler.log(l, pending)
+			})
+			defer timer.Stop()
+		}
 
 		res := internal.NewResponseWriter(w)
-		h.ServeHTTP(res, r)
+		cw, logCaptured := handler.captureBodies(res, r, fields)
+		err, stack := handler.serve(h, cw, r)
+		logCaptured()
+
+		e := &entry{start: start, latency: time.Since(start), w: res, r: r, body: body, fields: fields}
+		switch {
+		case err != nil:
+			e.marker, e.panic, e.stack = panicMarker, err, stack
+		case threshold > 0 && e.latency >= threshold:
+			e.marker = slowMarker
+		}
 
-		latency := time.Since(start)
-		l.Print(applyLogFormat(handler.format, latency, res, r))
+		if sampled || res.Status() >= 400 || e.marker != "" {
+			handler.log(l, e)
+		}
 	})
 }
 
-func userIP(req *http.Request) string {
-	ip, _, err := net.SplitHostPort(req.RemoteAddr)
-	if err != nil {
-		return ""
+// log writes the log entry for the request, either to the structured logger or to the
+// standard logger.
+func (l *handler) log(lg *log.Logger, e *entry) {
+	if l.slog != nil {
+		l.logSlog(e)
+		return
+	}
+
+	bp := buffers.Get().(*[]byte)
+	buf := l.render((*bp)[:0], e)
+	lg.Output(2, string(buf))
+
+	if cap(buf) <= maxPooledBuffer {
+		*bp = buf
+		buffers.Put(bp)
 	}
-	return ip
 }
 
-func urlScheme(req *http.Request) string {
-	if req.TLS != nil {
-		return "https://"
+// render appends the log line for the request to buf, either as text or JSON.
+func (l *handler) render(buf []byte, e *entry) []byte {
+	if l.json {
+		return l.template.appendJSON(buf, e, l.name)
 	}
-	return "http://"
+
+	buf = l.template.appendText(buf, e, l.empty)
+	if l.preset {
+		return buf
+	}
+	if e.fields != nil {
+		buf = e.fields.appendText(buf)
+	}
+	if e.marker != "" {
+		buf = append(buf, " ["...)
+		buf = append(buf, e.marker...)
+		buf = append(buf, ']')
+	}
+	if e.panic != nil {
+		buf = l.appendPanic(buf, e)
+	}
+	return buf
 }
 
-func remoteUser(req *http.Request) string {
-	user, _, _ := req.BasicAuth()
-	if user == "" && req.URL.User != nil {
-		user = req.URL.User.Username()
+// requestID returns the request ID assigned by requestid.Handler. If the request's context
+// does not carry it, the ID sent in the response headers is used instead.
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id, ok := requestid.FromContext(r.Context()); ok {
+		return id
 	}
 
-	return user
+	if id := w.Header().Get(requestid.DefaultHeader); id != "" {
+		return id
+	}
+	return w.Header().Get("Request-ID")
 }
 
-func applyLogFormat(format string, latency time.Duration, w http.ResponseWriter, r *http.Request) string {
-	reqID := w.Header().Get("Request-ID")
+// traceID returns the ID of the trace the request is part of, if traced by tracing.Handler.
+func traceID(req *http.Request) string {
+	if s, ok := tracing.FromContext(req.Context()); ok {
+		return s.TraceID.String()
+	}
+	return ""
+}
 
-	values := map[string]string{
-		"{remote_ip}":   userIP(r),
-		"{remote_user}": remoteUser(r),
-		"{id}":          reqID,
-		"{method}":      r.Method,
-		"{url}":         r.URL.Path,
-		"{query}":       r.URL.RawQuery,
-		"{rxbytes}":     strconv.FormatInt(r.ContentLength, 10),
-		"{useragent}":   r.UserAgent(),
-		"{host}":        r.Host,
-		"{referer}":     r.Referer(),
-		"{scheme}":      urlScheme(r),
+// spanID returns the ID of the request's span, if traced by tracing.Handler.
+func spanID(req *http.Request) string {
+	if s, ok := tracing.FromContext(req.Context()); ok {
+		return s.SpanID.String()
 	}
+	return ""
+}
 
-	for k, v := range values {
-		if strings.Contains(format, k) {
-			format = strings.Replace(format, k, v, -1)
-		}
+// remoteIP returns the client IP resolved by clientip.Handler. If the request's context
+// does not carry it, the remote address of the connection is used instead.
+func remoteIP(req *http.Request) string {
+	if ip, ok := clientip.FromContext(req.Context()); ok {
+		return ip.String()
 	}
+	return userIP(req)
+}
 
-	if strings.Contains(format, "{latency_human}") {
-		l := "..."
-		if latency > -1 {
-			l = latency.String()
-		}
-		format = strings.Replace(format, "{latency_human}", l, -1)
+func userIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return ""
 	}
+	return ip
+}
 
-	if strings.Contains(format, "{latency}") {
-		l := "..."
-		if latency > -1 {
-			l = strconv.FormatInt(latency.Nanoseconds(), 10)
-		}
-		format = strings.Replace(format, "{latency}", l, -1)
+func requestURI(req *http.Request) string {
+	if req.RequestURI != "" {
+		return req.RequestURI
 	}
+	return req.URL.RequestURI()
+}
 
-	if strings.Contains(format, "{txbytes}") {
-		size := "..."
-		if v, ok := w.(internal.ResponseWriter); ok {
-			size = strconv.Itoa(v.Size())
-		}
-		format = strings.Replace(format, "{txbytes}", size, -1)
+func urlScheme(req *http.Request) string {
+	if req.TLS != nil {
+		return "https://"
 	}
+	return "http://"
+}
 
-	if strings.Contains(format, "{status}") {
-		status := "..."
-		if v, ok := w.(internal.ResponseWriter); ok {
-			status = strconv.Itoa(v.Status())
-		}
-		format = strings.Replace(format, "{status}", status, -1)
+func remoteUser(req *http.Request) string {
+	user, _, _ := req.BasicAuth()
+	if user == "" && req.URL.User != nil {
+		user = req.URL.User.Username()
 	}
 
-	return format
+	return user
 }
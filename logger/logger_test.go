@@ -6,11 +6,20 @@ package logger
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/c4milo/handlers/clientip"
+	"github.com/c4milo/handlers/requestid"
+	"github.com/c4milo/handlers/tracing"
 	"github.com/hooklift/assert"
 )
 
@@ -29,3 +38,267 @@ func TestHandler(t *testing.T) {
 	assert.Ok(t, err)
 	assert.Cond(t, logging.String() != "", "Log output should not be empty.")
 }
+
+func TestHandlerJSON(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	})
+
+	logging := new(bytes.Buffer)
+	logHandler := Handler(requestHandler, AppName("test"), Output(logging), JSON(true))
+
+	req := httptest.NewRequest("GET", "/hello?a=b", nil)
+	logHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(logging.String()), "\n")
+	assert.Equals(t, 2, len(lines))
+
+	var start map[string]interface{}
+	assert.Ok(t, json.Unmarshal([]byte(lines[0]), &start))
+	_, ok := start["status"]
+	assert.Equals(t, false, ok)
+
+	var entry struct {
+		Time     string `json:"time"`
+		App      string `json:"app"`
+		Method   string `json:"method"`
+		URL      string `json:"url"`
+		Query    string `json:"query"`
+		Status   int    `json:"status"`
+		Latency  int64  `json:"latency"`
+		TxBytes  int    `json:"txbytes"`
+		RxBytes  int64  `json:"rxbytes"`
+		RemoteIP string `json:"remote_ip"`
+	}
+	assert.Ok(t, json.Unmarshal([]byte(lines[1]), &entry))
+
+	_, err := time.Parse(time.RFC3339Nano, entry.Time)
+	assert.Ok(t, err)
+	assert.Equals(t, "test", entry.App)
+	assert.Equals(t, "GET", entry.Method)
+	assert.Equals(t, "/hello", entry.URL)
+	assert.Equals(t, "a=b", entry.Query)
+	assert.Equals(t, http.StatusOK, entry.Status)
+	assert.Equals(t, 14, entry.TxBytes)
+	assert.Equals(t, int64(0), entry.RxBytes)
+	assert.Equals(t, "192.0.2.1", entry.RemoteIP)
+	assert.Cond(t, entry.Latency > 0, "latency should be logged in nanoseconds")
+}
+
+func TestHandlerSlog(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+		fmt.Fprintln(w, "Hello, client")
+	})
+
+	tests := []struct {
+		path  string
+		level string
+	}{
+		{"/", "INFO"},
+		{"/missing", "WARN"},
+		{"/error", "ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			logging := new(bytes.Buffer)
+			logger := slog.New(slog.NewJSONHandler(logging, nil))
+			logHandler := Handler(requestHandler, AppName("test"), Slog(logger))
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			logHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+			// The line before serving the request is logged at Debug level.
+			lines := strings.Split(strings.TrimSpace(logging.String()), "\n")
+			assert.Equals(t, 1, len(lines))
+
+			var record map[string]interface{}
+			assert.Ok(t, json.Unmarshal([]byte(lines[0]), &record))
+			assert.Equals(t, tt.level, record["level"])
+			assert.Equals(t, "request completed", record["msg"])
+			assert.Equals(t, "test", record["app"])
+			assert.Equals(t, tt.path, record["url"])
+			assert.Equals(t, "GET", record["method"])
+			assert.Equals(t, float64(14), record["txbytes"])
+		})
+	}
+}
+
+// contextHandler is a context-aware slog handler adding the tenant carried by the
+// context to records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+		r.AddAttrs(slog.String("tenant", tenant))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func TestHandlerSlogContext(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	})
+
+	logging := new(bytes.Buffer)
+	logger := slog.New(contextHandler{slog.NewJSONHandler(logging, nil)})
+	logHandler := Handler(requestHandler, Slog(logger))
+
+	middleware := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithAttrs(r.Context(), slog.String("region", "eu"))
+		ctx = WithAttrs(ctx, slog.Int("shard", 3))
+		ctx = context.WithValue(ctx, tenantKey{}, "acme")
+		logHandler.ServeHTTP(w, r.WithContext(ctx))
+	})
+	middleware.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var record map[string]interface{}
+	assert.Ok(t, json.Unmarshal(logging.Bytes(), &record))
+	assert.Equals(t, "eu", record["region"])
+	assert.Equals(t, float64(3), record["shard"])
+	assert.Equals(t, "acme", record["tenant"])
+}
+
+func TestHandlerRequestID(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	})
+
+	logging := new(bytes.Buffer)
+	logHandler := Handler(requestHandler, Output(logging), Format("id={id}"), Flags(0))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(requestid.DefaultHeader, "abc-123")
+	requestid.Handler(logHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equals(t, "[unknown_app] id=abc-123\n[unknown_app] id=abc-123\n", logging.String())
+}
+
+func TestHandlerClientIP(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	logging := new(bytes.Buffer)
+	logHandler := Handler(requestHandler, Output(logging), Format("{remote_ip}"), Flags(0), StartLine(false))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(clientip.XForwardedFor, "198.51.100.1")
+	clientip.Handler(logHandler, clientip.WithTrustedProxies("10.0.0.0/8")).ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equals(t, "[unknown_app] 198.51.100.1\n", logging.String())
+}
+
+func TestHandlerTracing(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	t.Run("text", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logHandler := Handler(requestHandler, Output(logging), Format("{trace_id}"), Flags(0), StartLine(false))
+		tracing.Handler(logHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equals(t, "[unknown_app] 4bf92f3577b34da6a3ce929d0e0e4736\n", logging.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logHandler := Handler(requestHandler, Output(logging), Format("{method}"), JSON(true), StartLine(false))
+		tracing.Handler(logHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+		var entry map[string]interface{}
+		assert.Ok(t, json.Unmarshal(logging.Bytes(), &entry))
+		assert.Equals(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry["trace_id"])
+		assert.Cond(t, entry["span_id"] != "00f067aa0ba902b7", "the span ID should be the server span's")
+	})
+
+	t.Run("untraced", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logHandler := Handler(requestHandler, Output(logging), Format("{method}"), JSON(true), StartLine(false))
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		var entry map[string]interface{}
+		assert.Ok(t, json.Unmarshal(logging.Bytes(), &entry))
+		_, ok := entry["trace_id"]
+		assert.Equals(t, false, ok)
+	})
+}
+
+func TestHandlerPresets(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	})
+
+	tests := []struct {
+		name     string
+		format   string
+		user     string
+		expected *regexp.Regexp
+	}{
+		{"common", CommonLogFormat, "", regexp.MustCompile(
+			`^192\.0\.2\.1 - - \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /hello\?a=b HTTP/1\.1" 200 14\n$`)},
+		{"combined", CombinedLogFormat, "camilo", regexp.MustCompile(
+			`^192\.0\.2\.1 - camilo \[[^\]]+\] "GET /hello\?a=b HTTP/1\.1" 200 14 "https://example\.com/" "test-agent/1\.0"\n$`)},
+		{"w3c", W3CExtendedLogFormat, "", regexp.MustCompile(
+			`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} 192\.0\.2\.1 - GET /hello a=b 200 14 test-agent/1\.0 https://example\.com/\n$`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logging := new(bytes.Buffer)
+			logHandler := Handler(requestHandler, Output(logging), Preset(tt.format))
+
+			req := httptest.NewRequest("GET", "/hello?a=b", nil)
+			req.Header.Set("User-Agent", "test-agent/1.0")
+			req.Header.Set("Referer", "https://example.com/")
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, "secret")
+			}
+			logHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Cond(t, tt.expected.MatchString(logging.String()), "unexpected log line: %q", logging.String())
+		})
+	}
+}
+
+func TestHandlerPresetsEscaping(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name     string
+		format   string
+		expected *regexp.Regexp
+	}{
+		{"common", CommonLogFormat, regexp.MustCompile(
+			`^192\.0\.2\.1 - - \[[^\]]+\] "GET /hello HTTP/1\.1" 204 -\n$`)},
+		{"combined", CombinedLogFormat, regexp.MustCompile(
+			`^192\.0\.2\.1 - - \[[^\]]+\] "GET /hello HTTP/1\.1" 204 - "https://example\.com/\?q=\\"x\\"" "Mozilla/5\.0 \(X11; Linux\) \\"quoted\\" back\\\\slash\\x01"\n$`)},
+		{"w3c", W3CExtendedLogFormat, regexp.MustCompile(
+			`^\S+ \S+ 192\.0\.2\.1 - GET /hello - 204 0 Mozilla/5\.0\+\(X11;\+Linux\)\+"quoted"\+back\\slash\+ https://example\.com/\?q="x"\n$`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logging := new(bytes.Buffer)
+			logHandler := Handler(requestHandler, Output(logging), Preset(tt.format))
+
+			req := httptest.NewRequest("GET", "/hello", nil)
+			req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux) \"quoted\" back\\slash\x01")
+			req.Header.Set("Referer", `https://example.com/?q="x"`)
+			logHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Cond(t, tt.expected.MatchString(logging.String()), "unexpected log line: %q", logging.String())
+		})
+	}
+}
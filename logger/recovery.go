@@ -0,0 +1,88 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/c4milo/handlers/internal"
+)
+
+// panicMarker flags log lines of requests whose handler panicked.
+const panicMarker = "panic"
+
+// Recover enables recovering from panics in the wrapped handler. The request is logged,
+// regardless of the sampling rate, along with the panic value and the stack trace: text
+// lines end with " [panic]", the quoted value and a quoted stack field, and JSON lines and
+// structured records get "panic" and "stack" fields, structured records being logged at
+// Error level.
+//
+// If the handler did not write the response yet, a 500 Internal Server Error is sent, or
+// the error page set through ErrorPage. Panics with http.ErrAbortHandler are not recovered,
+// so that the server aborts the response as intended.
+func Recover(enabled bool) Option {
+	return func(l *handler) {
+		l.recover = enabled
+	}
+}
+
+// ErrorPage sets the function writing the response of requests whose handler panicked,
+// instead of a plain 500 Internal Server Error. It is called with the panic value, and
+// only if the handler did not write the response. See Recover.
+func ErrorPage(fn func(w http.ResponseWriter, r *http.Request, err interface{})) Option {
+	return func(l *handler) {
+		l.errorPage = fn
+	}
+}
+
+// serve serves the request, recovering from panics if enabled. It returns the recovered
+// panic value, if any, and the stack trace of the goroutine when it panicked.
+func (l *handler) serve(h http.Handler, w internal.ResponseWriter, r *http.Request) (err interface{}, stack []byte) {
+	if !l.recover {
+		h.ServeHTTP(w, r)
+		return nil, nil
+	}
+
+	defer func() {
+		if err = recover(); err == nil {
+			return
+		}
+		if err == http.ErrAbortHandler {
+			panic(err)
+		}
+		stack = debug.Stack()
+
+		if w.Written() {
+			return
+		}
+		if l.errorPage != nil {
+			l.errorPage(w, r, err)
+		}
+		if !w.Written() {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}()
+
+	h.ServeHTTP(w, r)
+	return nil, nil
+}
+
+// appendPanic appends the panic value and the stack trace of e to a text log line. Both
+// are escaped, quoted unless the format has its own escaper, so that they are logged on
+// the same line no matter what the panic value holds.
+func (l *handler) appendPanic(buf []byte, e *entry) []byte {
+	escape := l.escape
+	if escape == nil {
+		escape = strconv.AppendQuote
+	}
+
+	buf = append(buf, ' ')
+	buf = escape(buf, fmt.Sprint(e.panic))
+	buf = append(buf, " stack="...)
+	return escape(buf, string(e.stack))
+}
@@ -0,0 +1,122 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c4milo/handlers/requestid"
+	"github.com/hooklift/assert"
+)
+
+func TestHandlerRecover(t *testing.T) {
+	errorPage := func(w http.ResponseWriter, r *http.Request, err interface{}) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "oops: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		write  bool
+		opts   []Option
+		status int
+		body   string
+	}{
+		{"not written", false, nil, http.StatusInternalServerError, "Internal Server Error\n"},
+		{"already written", true, nil, http.StatusOK, "partial"},
+		{"error page", false, []Option{ErrorPage(errorPage)}, http.StatusServiceUnavailable, "oops: boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.write {
+					fmt.Fprint(w, "partial")
+				}
+				panic("boom")
+			})
+
+			logging := new(bytes.Buffer)
+			opts := append([]Option{Output(logging), Format("{id} {status}"), Flags(0), StartLine(false), Recover(true)}, tt.opts...)
+			logHandler := requestid.Handler(Handler(requestHandler, opts...), requestid.WithGenerator(func() string { return "abc" }))
+
+			rec := httptest.NewRecorder()
+			logHandler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+			assert.Equals(t, tt.status, rec.Code)
+			assert.Equals(t, tt.body, rec.Body.String())
+
+			line := fmt.Sprintf(`[unknown_app] abc %d [panic] "boom" stack="goroutine `, tt.status)
+			assert.Cond(t, strings.HasPrefix(logging.String(), line), "unexpected log line: %q", logging.String())
+			assert.Equals(t, 1, strings.Count(logging.String(), "\n"))
+			assert.Cond(t, strings.Contains(logging.String(), "recovery_test.go"), "stack trace should be logged")
+		})
+	}
+}
+
+func TestHandlerRecoverPreset(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(errors.New("bad input: " + r.URL.Query().Get("x")))
+	})
+
+	logging := new(bytes.Buffer)
+	logHandler := Handler(requestHandler, Output(logging), Preset(CombinedLogFormat), Recover(true))
+	logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?x=%0A1.2.3.4%20-%20-%20%5Bfake%5D", nil))
+
+	assert.Equals(t, 1, strings.Count(logging.String(), "\n"))
+	assert.Cond(t, strings.HasPrefix(logging.String(), "192.0.2.1 - - ["), "unexpected log line: %q", logging.String())
+	assert.Cond(t, !strings.Contains(logging.String(), "\n1.2.3.4"), "forged log line: %q", logging.String())
+}
+
+func TestHandlerRecoverJSON(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	logging := new(bytes.Buffer)
+	logHandler := Handler(requestHandler, Output(logging), Format("{status}"), JSON(true), StartLine(false), Recover(true))
+	logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var entry map[string]interface{}
+	assert.Ok(t, json.Unmarshal(logging.Bytes(), &entry))
+	assert.Equals(t, float64(http.StatusInternalServerError), entry["status"])
+	assert.Equals(t, panicMarker, entry["marker"])
+	assert.Equals(t, "boom", entry["panic"])
+	assert.Cond(t, strings.Contains(entry["stack"].(string), "recovery_test.go"), "stack trace should be logged")
+}
+
+func TestHandlerRecoverRepanics(t *testing.T) {
+	tests := []struct {
+		name string
+		err  interface{}
+		opts []Option
+	}{
+		{"abort handler", http.ErrAbortHandler, []Option{Recover(true)}},
+		{"disabled", "boom", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic(tt.err)
+			})
+
+			opts := append([]Option{Output(new(bytes.Buffer))}, tt.opts...)
+			logHandler := Handler(requestHandler, opts...)
+
+			defer func() {
+				assert.Equals(t, tt.err, recover())
+			}()
+			logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		})
+	}
+}
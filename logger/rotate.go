@@ -0,0 +1,265 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeLayout is the layout of the timestamp suffixed to the name of rotated files.
+const backupTimeLayout = "20060102T150405.000000000"
+
+// RotateOption configures a RotatingFile.
+type RotateOption func(*RotatingFile)
+
+// RotateMaxSize rotates the file before it grows past the given size, in bytes.
+func RotateMaxSize(bytes int64) RotateOption {
+	return func(f *RotatingFile) {
+		f.maxSize = bytes
+	}
+}
+
+// RotateEvery rotates the file once it has been written to for the given duration.
+func RotateEvery(d time.Duration) RotateOption {
+	return func(f *RotatingFile) {
+		f.interval = d
+	}
+}
+
+// MaxBackups sets the number of rotated files to keep, removing the oldest ones. Zero, the
+// default, keeps all of them.
+func MaxBackups(n int) RotateOption {
+	return func(f *RotatingFile) {
+		f.maxBackups = n
+	}
+}
+
+// CompressBackups enables compressing rotated files with gzip, in the background.
+func CompressBackups(enabled bool) RotateOption {
+	return func(f *RotatingFile) {
+		f.compress = enabled
+	}
+}
+
+// RotatingFile is an io.Writer appending to a file which is rotated based on its size,
+// its age or both. Rotated files are renamed after the file, suffixed with the time of
+// the rotation, for instance access.log.20060102T150405.000000000, and optionally
+// compressed. It is meant to be used with Output, on its own or through an AsyncWriter.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	compress   bool
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	// cleanup serializes compressing and removing rotated files.
+	cleanup sync.Mutex
+	wg      sync.WaitGroup
+}
+
+// NewRotatingFile opens the file at the given path for appending, creating it if needed.
+// It is never rotated unless RotateMaxSize or RotateEvery are given.
+func NewRotatingFile(path string, opts ...RotateOption) (*RotatingFile, error) {
+	f := &RotatingFile{path: path}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends p to the file, rotating it first if needed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.due(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file right away.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// Close closes the file and waits for rotated files to be compressed and removed.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.wg.Wait()
+	return err
+}
+
+// due returns whether the file has to be rotated before writing n bytes to it.
+func (f *RotatingFile) due(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+n > f.maxSize {
+		return true
+	}
+	return f.interval > 0 && time.Since(f.opened) >= f.interval
+}
+
+// open opens the file for appending.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size, f.opened = file, fi.Size(), time.Now()
+	return nil
+}
+
+// rotate renames the file, opens a new one and cleans up rotated files in the background.
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return err
+	}
+
+	backup := f.path + "." + time.Now().Format(backupTimeLayout)
+	if err := os.Rename(f.path, backup); err != nil {
+		// Keep writing to the current file.
+		if oerr := f.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.cleanup.Lock()
+		defer f.cleanup.Unlock()
+
+		if f.compress {
+			compressFile(backup)
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+// prune removes the oldest rotated files beyond the configured limit.
+func (f *RotatingFile) prune() {
+	if f.maxBackups <= 0 {
+		return
+	}
+
+	backups := f.backups()
+	if len(backups) <= f.maxBackups {
+		return
+	}
+	for _, b := range backups[:len(backups)-f.maxBackups] {
+		os.Remove(b)
+	}
+}
+
+// backups returns the paths of the rotated files, from the oldest to the newest.
+func (f *RotatingFile) backups() []string {
+	dir, base := filepath.Split(f.path)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return nil
+	}
+
+	var backups []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base+".") {
+			continue
+		}
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, base+"."), ".gz")
+		if _, err := time.Parse(backupTimeLayout, suffix); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, name))
+	}
+
+	// Timestamps sort chronologically.
+	sort.Strings(backups)
+	return backups
+}
+
+// compressFile replaces the given file with its gzip compressed version. The original file
+// is kept if compression fails.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(out)
+	if _, err = io.Copy(gw, in); err == nil {
+		err = gw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	in.Close()
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,94 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hooklift/assert"
+)
+
+func TestRotatingFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := NewRotatingFile(path, RotateMaxSize(10))
+	assert.Ok(t, err)
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		_, err := f.Write([]byte(line))
+		assert.Ok(t, err)
+	}
+	assert.Ok(t, f.Close())
+
+	backups := f.backups()
+	assert.Equals(t, 2, len(backups))
+	assert.Equals(t, "first\n", readFile(t, backups[0]))
+	assert.Equals(t, "second\n", readFile(t, backups[1]))
+	assert.Equals(t, "third\n", readFile(t, path))
+
+	_, err = f.Write([]byte("closed\n"))
+	assert.Equals(t, os.ErrClosed, err)
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := NewRotatingFile(path, RotateEvery(time.Millisecond))
+	assert.Ok(t, err)
+
+	_, err = f.Write([]byte("first\n"))
+	assert.Ok(t, err)
+	time.Sleep(2 * time.Millisecond)
+	_, err = f.Write([]byte("second\n"))
+	assert.Ok(t, err)
+	assert.Ok(t, f.Close())
+
+	assert.Equals(t, 1, len(f.backups()))
+	assert.Equals(t, "second\n", readFile(t, path))
+}
+
+func TestRotatingFileBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := NewRotatingFile(path, MaxBackups(2), CompressBackups(true))
+	assert.Ok(t, err)
+
+	for _, line := range []string{"1\n", "2\n", "3\n", "4\n"} {
+		_, err := f.Write([]byte(line))
+		assert.Ok(t, err)
+		assert.Ok(t, f.Rotate())
+	}
+	assert.Ok(t, f.Close())
+
+	backups := f.backups()
+	assert.Equals(t, 2, len(backups))
+	for i, b := range backups {
+		assert.Cond(t, strings.HasSuffix(b, ".gz"), "%s should be compressed", b)
+
+		file, err := os.Open(b)
+		assert.Ok(t, err)
+		gr, err := gzip.NewReader(file)
+		assert.Ok(t, err)
+		data, err := ioutil.ReadAll(gr)
+		assert.Ok(t, err)
+		file.Close()
+
+		assert.Equals(t, []string{"3\n", "4\n"}[i], string(data))
+	}
+
+	// Unrelated files are left alone.
+	assert.Ok(t, ioutil.WriteFile(filepath.Join(dir, "access.log.old"), nil, 0644))
+	assert.Equals(t, 2, len(f.backups()))
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	assert.Ok(t, err)
+	return string(data)
+}
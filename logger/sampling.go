@@ -0,0 +1,55 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+)
+
+// StartLine enables or disables the line logged before serving the request, with
+// placeholders for the values not known yet. It is enabled by default, except when
+// using Preset.
+func StartLine(enabled bool) Option {
+	return func(l *handler) {
+		l.skipStart = !enabled
+	}
+}
+
+// Sample logs only the given fraction of the requests, from 0 to 1. Requests failing with
+// a 4xx or 5xx status, as well as slow requests, see SlowThreshold, are always logged.
+// Defaults to 1, logging every request.
+//
+// Sampling is deterministic per request ID: the decision is taken from the FNV-1a hash of
+// the ID, so that every handler sampling at the same rate keeps the logs of the same
+// requests. Requests without an ID are sampled randomly. Since the start line is logged
+// before knowing the outcome, it is only logged for sampled requests.
+func Sample(rate float64) Option {
+	return func(l *handler) {
+		l.rate = rate
+	}
+}
+
+// sampled returns whether the request is part of the sample to log.
+func (l *handler) sampled(w http.ResponseWriter, r *http.Request) bool {
+	if l.rate >= 1 {
+		return true
+	}
+	if l.rate <= 0 {
+		return false
+	}
+
+	id := requestID(w, r)
+	if id == "" {
+		return rand.Float64() < l.rate
+	}
+
+	h := fnv.New32a()
+	io.WriteString(h, id)
+	return float64(h.Sum32()) < l.rate*(math.MaxUint32+1)
+}
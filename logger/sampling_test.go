@@ -0,0 +1,90 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c4milo/handlers/requestid"
+	"github.com/hooklift/assert"
+)
+
+func TestHandlerStartLine(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	})
+
+	logging := new(bytes.Buffer)
+	logHandler := Handler(requestHandler, Output(logging), Format("{status}"), Flags(0), StartLine(false))
+	logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Equals(t, "[unknown_app] 200\n", logging.String())
+}
+
+func TestHandlerSample(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/slow":
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		rate   float64
+		logged bool
+	}{
+		{"all", "/", 1, true},
+		{"none", "/", 0, false},
+		{"error", "/error", 0, true},
+		{"slow", "/slow", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logging := new(bytes.Buffer)
+			logHandler := Handler(requestHandler, Output(logging), Format("{url}"), Flags(0),
+				StartLine(false), Sample(tt.rate), SlowThreshold(time.Millisecond))
+			logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+
+			assert.Equals(t, tt.logged, logging.Len() > 0)
+		})
+	}
+}
+
+func TestHandlerSampleDeterministic(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	logging := new(bytes.Buffer)
+	logHandler := requestid.Handler(Handler(requestHandler, Output(logging), Format("{id}"), Flags(0), Sample(0.5)))
+
+	const n = 1000
+	for i := 0; i < n; i++ {
+		for j := 0; j < 2; j++ {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(requestid.DefaultHeader, fmt.Sprintf("request-%d", i))
+			logHandler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+
+	// Both the start and end lines of both requests sharing an ID are either logged or not.
+	counts := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(logging.String()), "\n") {
+		counts[line]++
+	}
+	for id, count := range counts {
+		assert.Cond(t, count == 4, "%s was logged %d times", id, count)
+	}
+	assert.Cond(t, len(counts) > n/3 && len(counts) < 2*n/3, "%d requests out of %d were sampled", len(counts), n)
+}
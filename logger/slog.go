@@ -0,0 +1,100 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/c4milo/handlers/internal"
+)
+
+// Slog sends request logs to the given structured logger instead of Output. Each request
+// is logged as a record with the application name and the values of the directives used
+// in the log format as typed attributes, keyed by directive name.
+//
+// The level follows the response status: Error for 5xx, Warn for 4xx and Info otherwise.
+// The line logged before serving the request is logged at Debug level. Records carry the
+// attributes attached to the request's context through WithAttrs, and are logged with
+// that context, so context-aware slog handlers can add attributes of their own.
+func Slog(logger *slog.Logger) Option {
+	return func(l *handler) {
+		l.slog = logger
+	}
+}
+
+// logSlog logs the request as a structured record.
+func (l *handler) logSlog(e *entry) {
+	ctx := e.r.Context()
+
+	level, msg := slog.LevelDebug, "request started"
+	switch {
+	case e.marker == runningMarker:
+		level, msg = slog.LevelWarn, "request still running"
+	case e.latency > -1:
+		var status int
+		if res, ok := e.w.(internal.ResponseWriter); ok {
+			status = res.Status()
+		}
+		level, msg = statusLevel(status), "request completed"
+		if e.marker != "" && level < slog.LevelWarn {
+			level = slog.LevelWarn
+		}
+		if e.panic != nil {
+			level, msg = slog.LevelError, "request panicked"
+		}
+	}
+
+	if !l.slog.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := make([]slog.Attr, 1, len(l.template.fields)+4)
+	attrs[0] = slog.String("app", l.name)
+	attrs = l.template.appendAttrs(attrs, e)
+	if e.fields != nil {
+		attrs = e.fields.appendAttrs(attrs, l.template.reserved)
+	}
+	if e.marker != "" {
+		attrs = append(attrs, slog.String("marker", e.marker))
+	}
+	if e.panic != nil {
+		attrs = append(attrs, slog.Any("panic", e.panic), slog.String("stack", string(e.stack)))
+	}
+	attrs = append(attrs, attrsFromContext(ctx)...)
+
+	l.slog.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// attrsKey is the key used to store structured logging attributes in a context.
+type attrsKey struct{}
+
+// WithAttrs returns a new context carrying the given attributes, in addition to the ones
+// the parent context carries already. Middleware wrapping Handler uses it to add
+// attributes, such as the tenant, to the records logged through Slog.
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	parent := attrsFromContext(ctx)
+	merged := make([]slog.Attr, 0, len(parent)+len(attrs))
+	merged = append(merged, parent...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, attrsKey{}, merged)
+}
+
+// attrsFromContext returns the attributes carried by the given context.
+func attrsFromContext(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// statusLevel returns the log level for the given response status.
+func statusLevel(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
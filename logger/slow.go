@@ -0,0 +1,78 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Markers flagging log lines of slow requests.
+const (
+	slowMarker    = "slow"
+	runningMarker = "still running"
+)
+
+// SlowThreshold sets the latency from which requests are considered slow. Zero, the
+// default, disables it. Slow requests are always logged, regardless of the sampling rate,
+// and flagged: text lines end with " [slow]", JSON lines have a "marker" field set to
+// "slow" and structured records get the same attribute and are logged at Warn level at
+// least.
+func SlowThreshold(d time.Duration) Option {
+	return func(l *handler) {
+		l.slowThreshold = d
+	}
+}
+
+// SlowPath sets the slow threshold of the requests whose path starts with prefix,
+// overriding SlowThreshold. If several prefixes match, the longest one is used. A zero
+// duration disables slow request detection for the matching requests.
+func SlowPath(prefix string, d time.Duration) Option {
+	return func(l *handler) {
+		if l.slowPaths == nil {
+			l.slowPaths = make(map[string]time.Duration)
+		}
+		l.slowPaths[prefix] = d
+	}
+}
+
+// StillRunning enables logging a line for the requests still being served once they
+// reach their slow threshold, so hung handlers show up before they complete. The line
+// is flagged "still running" the same way slow requests are, and values only known once
+// the request has been served, such as the status, are logged as placeholders. It has no
+// effect with Preset, whose lines have no room for these placeholders.
+func StillRunning(enabled bool) Option {
+	return func(l *handler) {
+		l.stillRunning = enabled
+	}
+}
+
+// threshold returns the slow threshold of the request, zero if there is none.
+func (l *handler) threshold(r *http.Request) time.Duration {
+	d, n := l.slowThreshold, -1
+	for prefix, pd := range l.slowPaths {
+		if len(prefix) > n && strings.HasPrefix(r.URL.Path, prefix) {
+			d, n = pd, len(prefix)
+		}
+	}
+	return d
+}
+
+// pendingResponse stands in for the response of a request still being served, which
+// cannot be read safely while the handler writes it.
+type pendingResponse struct {
+	header http.Header
+}
+
+func (p pendingResponse) Header() http.Header {
+	return p.header
+}
+
+func (p pendingResponse) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (p pendingResponse) WriteHeader(int) {}
@@ -0,0 +1,146 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hooklift/assert"
+)
+
+func TestThreshold(t *testing.T) {
+	l := &handler{
+		slowThreshold: time.Second,
+		slowPaths: map[string]time.Duration{
+			"/api":        time.Millisecond,
+			"/api/export": time.Minute,
+			"/health":     0,
+		},
+	}
+
+	tests := []struct {
+		path     string
+		expected time.Duration
+	}{
+		{"/", time.Second},
+		{"/api/users", time.Millisecond},
+		{"/api/export/csv", time.Minute},
+		{"/health", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equals(t, tt.expected, l.threshold(httptest.NewRequest("GET", tt.path, nil)))
+		})
+	}
+}
+
+func TestHandlerSlow(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logHandler := Handler(requestHandler, Output(logging), Format("{url}"), Flags(0), StartLine(false),
+			SlowThreshold(time.Hour), SlowPath("/slow", time.Millisecond))
+
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fast", nil))
+
+		assert.Equals(t, "[unknown_app] /slow [slow]\n[unknown_app] /fast\n", logging.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logHandler := Handler(requestHandler, Output(logging), Format("{url}"), JSON(true), StartLine(false),
+			SlowThreshold(time.Millisecond))
+
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+
+		var entry map[string]interface{}
+		assert.Ok(t, json.Unmarshal(logging.Bytes(), &entry))
+		assert.Equals(t, "slow", entry["marker"])
+	})
+
+	t.Run("slog", func(t *testing.T) {
+		logging := new(bytes.Buffer)
+		logger := slog.New(slog.NewJSONHandler(logging, nil))
+		logHandler := Handler(requestHandler, Slog(logger), SlowThreshold(time.Millisecond))
+
+		logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+
+		var record map[string]interface{}
+		assert.Ok(t, json.Unmarshal(logging.Bytes(), &record))
+		assert.Equals(t, "WARN", record["level"])
+		assert.Equals(t, "slow", record["marker"])
+	})
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestHandlerStillRunning(t *testing.T) {
+	logging := new(syncBuffer)
+
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hang until the request is reported as still running.
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(logging.String(), runningMarker) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	logHandler := Handler(requestHandler, Output(logging), Format("{url} {status}"), Flags(0), StartLine(false),
+		SlowThreshold(time.Millisecond), StillRunning(true))
+	logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hung", nil))
+
+	lines := strings.Split(strings.TrimSpace(logging.String()), "\n")
+	assert.Equals(t, 2, len(lines))
+	assert.Equals(t, "[unknown_app] /hung ... [still running]", lines[0])
+	assert.Equals(t, "[unknown_app] /hung 202 [slow]", lines[1])
+}
+
+func TestHandlerStillRunningPreset(t *testing.T) {
+	logging := new(syncBuffer)
+
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	})
+
+	logHandler := Handler(requestHandler, Output(logging), Preset(CommonLogFormat),
+		SlowThreshold(time.Millisecond), StillRunning(true))
+	logHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hung", nil))
+
+	lines := strings.Split(strings.TrimSpace(logging.String()), "\n")
+	assert.Equals(t, 1, len(lines))
+	assert.Cond(t, !strings.Contains(lines[0], "..."), "unexpected placeholders: %q", lines[0])
+}
@@ -0,0 +1,470 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/c4milo/handlers/internal"
+)
+
+// maxPooledBuffer is the capacity above which buffers are not returned to the pool, so
+// that a few large log lines do not pin memory.
+const maxPooledBuffer = 64 << 10
+
+// buffers pools the buffers log lines are rendered into.
+var buffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+// entry holds the request being logged. latency is -1 before serving the request.
+type entry struct {
+	start   time.Time
+	latency time.Duration
+	w       http.ResponseWriter
+	r       *http.Request
+	// body counts the bytes read from the request body, nil if there is none.
+	body *body
+	// fields hold the fields set by handlers, nil before serving the request.
+	fields *Fields
+	// marker flags slow requests or requests whose handler panicked.
+	marker string
+	// panic holds the value the handler panicked with, and stack its stack trace.
+	panic interface{}
+	stack []byte
+}
+
+type valueKind uint8
+
+const (
+	// kindUnknown is used for values not known yet, such as the status before serving.
+	kindUnknown valueKind = iota
+	kindString
+	kindInt
+	kindAny
+)
+
+// value is the typed value of a directive. Strings and integers are stored apart from
+// other values so that they can be rendered without allocating.
+type value struct {
+	kind valueKind
+	str  string
+	num  int64
+	any  interface{}
+}
+
+func stringValue(s string) value {
+	return value{kind: kindString, str: s}
+}
+
+func intValue(n int64) value {
+	return value{kind: kindInt, num: n}
+}
+
+// anyValue returns the value of v, unknown if v is nil.
+func anyValue(v interface{}) value {
+	switch v := v.(type) {
+	case nil:
+		return value{}
+	case string:
+		return stringValue(v)
+	case int:
+		return intValue(int64(v))
+	case int64:
+		return intValue(v)
+	}
+	return value{kind: kindAny, any: v}
+}
+
+// appendText appends the textual form of v to buf. Unknown values are rendered as "..."
+// and empty ones as the given placeholder.
+func (v value) appendText(buf []byte, empty string) []byte {
+	s := v.str
+	switch v.kind {
+	case kindUnknown:
+		return append(buf, "..."...)
+	case kindInt:
+		return strconv.AppendInt(buf, v.num, 10)
+	case kindAny:
+		s = fmt.Sprint(v.any)
+	}
+
+	if s == "" {
+		s = empty
+	}
+	return append(buf, s...)
+}
+
+// appendJSON appends the JSON encoding of v to buf.
+func (v value) appendJSON(buf []byte) []byte {
+	switch v.kind {
+	case kindInt:
+		return strconv.AppendInt(buf, v.num, 10)
+	case kindAny:
+		b, err := json.Marshal(v.any)
+		if err != nil {
+			return appendJSONString(buf, fmt.Sprint(v.any))
+		}
+		return append(buf, b...)
+	}
+	return appendJSONString(buf, v.str)
+}
+
+// attr returns v as a structured logging attribute.
+func (v value) attr(key string) slog.Attr {
+	switch v.kind {
+	case kindString:
+		return slog.String(key, v.str)
+	case kindInt:
+		return slog.Int64(key, v.num)
+	}
+	return slog.Any(key, v.any)
+}
+
+// directiveValues hold the functions returning the values of the directives without
+// arguments.
+var directiveValues = map[string]func(*entry) value{
+	"remote_ip":      func(e *entry) value { return stringValue(remoteIP(e.r)) },
+	"remote_user":    func(e *entry) value { return stringValue(remoteUser(e.r)) },
+	"id":             func(e *entry) value { return stringValue(requestID(e.w, e.r)) },
+	"method":         func(e *entry) value { return stringValue(e.r.Method) },
+	"url":            func(e *entry) value { return stringValue(e.r.URL.Path) },
+	"query":          func(e *entry) value { return stringValue(e.r.URL.RawQuery) },
+	"useragent":      func(e *entry) value { return stringValue(e.r.UserAgent()) },
+	"host":           func(e *entry) value { return stringValue(e.r.Host) },
+	"referer":        func(e *entry) value { return stringValue(e.r.Referer()) },
+	"scheme":         func(e *entry) value { return stringValue(urlScheme(e.r)) },
+	"proto":          func(e *entry) value { return stringValue(e.r.Proto) },
+	"uri":            func(e *entry) value { return stringValue(requestURI(e.r)) },
+	"time_local":     func(e *entry) value { return stringValue(e.start.Format(clfTimeLayout)) },
+	"utc_date":       func(e *entry) value { return stringValue(e.start.UTC().Format("2006-01-02")) },
+	"utc_time":       func(e *entry) value { return stringValue(e.start.UTC().Format("15:04:05")) },
+	"trace_id":       func(e *entry) value { return stringValue(traceID(e.r)) },
+	"span_id":        func(e *entry) value { return stringValue(spanID(e.r)) },
+	"rxbytes":        rxbytes,
+	"rxbytes_unread": rxbytesUnread,
+	"latency": func(e *entry) value {
+		if e.latency < 0 {
+			return value{}
+		}
+		return intValue(e.latency.Nanoseconds())
+	},
+	"latency_human": func(e *entry) value {
+		if e.latency < 0 {
+			return value{}
+		}
+		return stringValue(e.latency.String())
+	},
+	"txbytes": func(e *entry) value {
+		if res, ok := e.w.(internal.ResponseWriter); ok {
+			return intValue(int64(res.Size()))
+		}
+		return value{}
+	},
+	"status": func(e *entry) value {
+		if res, ok := e.w.(internal.ResponseWriter); ok {
+			return intValue(int64(res.Status()))
+		}
+		return value{}
+	},
+}
+
+// reservedKeys are the keys logged in JSON lines and structured records besides the
+// directives, including the ones slog handlers add.
+var reservedKeys = []string{"time", "level", "msg", "app", "marker", "panic", "stack"}
+
+// segment is a piece of a compiled log format: either literal text or a directive.
+type segment struct {
+	literal string
+	name    string
+	value   func(*entry) value
+	// escape is set for directives whose values are controlled by the client, such as
+	// {cookie:name}, escaped in text mode even if the format has no escaper.
+	escape bool
+}
+
+// template is a log format parsed once into a sequence of segments, so that rendering a
+// log line does not need to scan the format again.
+type template struct {
+	segments []segment
+	// escape escapes string values in text mode, nil if they are logged as is.
+	escape func(buf []byte, s string) []byte
+	// fields hold the values logged in JSON and structured records: the directive
+	// segments without duplicates, in order of appearance, and the trace IDs.
+	fields []segment
+	// reserved holds the keys logged by the handler in JSON and structured records,
+	// which fields set by handlers are not logged with.
+	reserved map[string]bool
+}
+
+// compile parses the given log format. Unknown directives are kept as literal text.
+func (l *handler) compile(format string) *template {
+	t := &template{escape: l.escape}
+	seen := make(map[string]bool)
+
+	for {
+		start := strings.IndexByte(format, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(format[start:], '}')
+		if end < 0 {
+			break
+		}
+
+		name := format[start+1 : start+end]
+		fn, ok := l.field(name)
+		if !ok {
+			t.literal(format[:start+1])
+			format = format[start+1:]
+			continue
+		}
+
+		t.literal(format[:start])
+		seg := segment{name: name, value: fn}
+		text := segment{name: name, value: fn, escape: strings.IndexByte(name, ':') >= 0}
+		if name == "txbytes" && l.dashZeroBytes {
+			text.value = dashZero(fn)
+		}
+		t.segments = append(t.segments, text)
+		if !seen[name] {
+			seen[name] = true
+			t.fields = append(t.fields, seg)
+		}
+		format = format[start+end+1:]
+	}
+	t.literal(format)
+
+	// Structured output always carries the trace IDs of traced requests.
+	for _, name := range []string{"trace_id", "span_id"} {
+		if seen[name] {
+			continue
+		}
+		fn := directiveValues[name]
+		t.fields = append(t.fields, segment{name: name, value: func(e *entry) value {
+			if v := fn(e); v.str != "" {
+				return v
+			}
+			return value{}
+		}})
+	}
+
+	t.reserved = make(map[string]bool, len(t.fields)+len(reservedKeys))
+	for _, k := range reservedKeys {
+		t.reserved[k] = true
+	}
+	for _, s := range t.fields {
+		t.reserved[s.name] = true
+	}
+	return t
+}
+
+// literal appends literal text to the template, merging it with the previous segment
+// if it is literal too.
+func (t *template) literal(s string) {
+	if s == "" {
+		return
+	}
+	if n := len(t.segments); n > 0 && t.segments[n-1].value == nil {
+		t.segments[n-1].literal += s
+		return
+	}
+	t.segments = append(t.segments, segment{literal: s})
+}
+
+// field returns the function computing the value of the given directive. It returns
+// false if the directive is unknown.
+func (l *handler) field(directive string) (func(*entry) value, bool) {
+	if fn, ok := directiveValues[directive]; ok {
+		return fn, true
+	}
+	return l.dynamicField(directive)
+}
+
+// appendText appends the log line for e to buf.
+func (t *template) appendText(buf []byte, e *entry, empty string) []byte {
+	for _, s := range t.segments {
+		if s.value == nil {
+			buf = append(buf, s.literal...)
+			continue
+		}
+		v := s.value(e)
+		escape := t.escape
+		if escape == nil && s.escape {
+			escape = appendCLFEscaped
+		}
+		if escape == nil || v.kind == kindUnknown || v.kind == kindInt {
+			buf = v.appendText(buf, empty)
+			continue
+		}
+
+		str := v.str
+		if v.kind == kindAny {
+			str = fmt.Sprint(v.any)
+		}
+		if str == "" {
+			buf = append(buf, empty...)
+			continue
+		}
+		buf = escape(buf, str)
+	}
+	return buf
+}
+
+// dashZero returns a function computing the value of an integer directive, replaced with
+// an empty value when zero so that it is logged as the empty placeholder.
+func dashZero(fn func(*entry) value) func(*entry) value {
+	return func(e *entry) value {
+		v := fn(e)
+		if v.kind == kindInt && v.num == 0 {
+			return stringValue("")
+		}
+		return v
+	}
+}
+
+// appendCLFEscaped appends s to buf the way Apache escapes values in its access logs:
+// quotes and backslashes are escaped with a backslash, and non-printable bytes are
+// logged as \xhh, so that quoted fields cannot be broken out of.
+func appendCLFEscaped(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c == '\n':
+			buf = append(buf, '\\', 'n')
+		case c == '\t':
+			buf = append(buf, '\\', 't')
+		case c < 0x20 || c == 0x7f:
+			buf = append(buf, '\\', 'x', hexDigits[c>>4], hexDigits[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// appendW3CEscaped appends s to buf as a field of the W3C Extended Log File Format, whose
+// fields are separated by spaces: spaces are replaced with "+", as the format allows, and
+// so are other whitespace and control characters.
+func appendW3CEscaped(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c == 0x7f {
+			buf = append(buf, '+')
+			continue
+		}
+		buf = append(buf, s[i])
+	}
+	return buf
+}
+
+// appendJSON appends a JSON object with the time, the application name and the values
+// of the directives in the template to buf. Values not known yet are left out.
+func (t *template) appendJSON(buf []byte, e *entry, app string) []byte {
+	buf = append(buf, `{"time":"`...)
+	buf = time.Now().AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, `","app":`...)
+	buf = appendJSONString(buf, app)
+
+	for _, s := range t.fields {
+		v := s.value(e)
+		if v.kind == kindUnknown {
+			continue
+		}
+		buf = append(buf, ',')
+		buf = appendJSONString(buf, s.name)
+		buf = append(buf, ':')
+		buf = v.appendJSON(buf)
+	}
+
+	if e.fields != nil {
+		buf = e.fields.appendJSON(buf, t.reserved)
+	}
+	if e.marker != "" {
+		buf = append(buf, `,"marker":`...)
+		buf = appendJSONString(buf, e.marker)
+	}
+	if e.panic != nil {
+		buf = append(buf, `,"panic":`...)
+		buf = appendJSONString(buf, fmt.Sprint(e.panic))
+		buf = append(buf, `,"stack":`...)
+		buf = appendJSONString(buf, string(e.stack))
+	}
+	return append(buf, '}')
+}
+
+// appendAttrs appends the values of the directives in the template to attrs. Values not
+// known yet are left out.
+func (t *template) appendAttrs(attrs []slog.Attr, e *entry) []slog.Attr {
+	for _, s := range t.fields {
+		v := s.value(e)
+		if v.kind == kindUnknown {
+			continue
+		}
+		attrs = append(attrs, v.attr(s.name))
+	}
+	return attrs
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s to buf as a JSON string, escaped the same way
+// encoding/json does.
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, "\ufffd"...)
+		case r == '\u2028' || r == '\u2029':
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+		default:
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
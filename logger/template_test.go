@@ -0,0 +1,180 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c4milo/handlers/internal"
+	"github.com/hooklift/assert"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"", ""},
+		{"plain text", "plain text"},
+		{"{method} {url}", "GET /hello"},
+		{"{method}{method}", "GETGET"},
+		{"{unknown} {method}", "{unknown} GET"},
+		{"{a{method}}", "{aGET}"},
+		{"{method", "{method"},
+		{"status={status} latency={latency}", "status=... latency=..."},
+		{"[{query_param:missing}]", "[-]"},
+	}
+
+	l := &handler{}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			e := &entry{
+				start:   time.Now(),
+				latency: -1,
+				w:       httptest.NewRecorder(),
+				r:       httptest.NewRequest("GET", "/hello", nil),
+			}
+			buf := l.compile(tt.format).appendText(nil, e, "-")
+			assert.Equals(t, tt.expected, string(buf))
+		})
+	}
+}
+
+func TestAppendJSONString(t *testing.T) {
+	tests := []string{
+		"",
+		"hello",
+		`quote " and backslash \`,
+		"new\nline\ttab\rreturn",
+		"\x00\x1f control",
+		"<script>&</script>",
+		"ünïcödé 日本語",
+		"invalid \xff utf-8",
+		"line \u2028 separators \u2029",
+	}
+
+	for _, s := range tests {
+		expected, err := json.Marshal(s)
+		assert.Ok(t, err)
+		assert.Equals(t, string(expected), string(appendJSONString(nil, s)))
+	}
+}
+
+// benchmarkEntry returns an entry for a served request.
+func benchmarkEntry() *entry {
+	req := httptest.NewRequest("GET", "/hello?a=b", nil)
+	req.Header.Set("User-Agent", "benchmark/1.0")
+	res := internal.NewResponseWriter(httptest.NewRecorder())
+	res.WriteHeader(http.StatusOK)
+	return &entry{start: time.Now(), latency: 1500 * time.Microsecond, w: res, r: req}
+}
+
+func BenchmarkTemplateText(b *testing.B) {
+	l := &handler{}
+	t := l.compile(defaultFormat)
+	e := benchmarkEntry()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bp := buffers.Get().(*[]byte)
+		*bp = t.appendText((*bp)[:0], e, "")
+		buffers.Put(bp)
+	}
+}
+
+func BenchmarkTemplateJSON(b *testing.B) {
+	l := &handler{}
+	t := l.compile(defaultFormat)
+	e := benchmarkEntry()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bp := buffers.Get().(*[]byte)
+		*bp = t.appendJSON((*bp)[:0], e, "benchmark")
+		buffers.Put(bp)
+	}
+}
+
+// replaced keeps the compiler from optimizing away the benchmarked calls.
+var replaced string
+
+// BenchmarkReplaceText measures the approach templates replaced, applyLogFormat below,
+// copied verbatim from the previous version of the logger.
+func BenchmarkReplaceText(b *testing.B) {
+	e := benchmarkEntry()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		replaced = applyLogFormat(defaultFormat, e.latency, e.w, e.r)
+	}
+}
+
+// applyLogFormat renders a log line the way the logger did before templates.
+func applyLogFormat(format string, latency time.Duration, w http.ResponseWriter, r *http.Request) string {
+	reqID := w.Header().Get("Request-ID")
+
+	values := map[string]string{
+		"{remote_ip}":   userIP(r),
+		"{remote_user}": remoteUser(r),
+		"{id}":          reqID,
+		"{method}":      r.Method,
+		"{url}":         r.URL.Path,
+		"{query}":       r.URL.RawQuery,
+		"{rxbytes}":     strconv.FormatInt(r.ContentLength, 10),
+		"{useragent}":   r.UserAgent(),
+		"{host}":        r.Host,
+		"{referer}":     r.Referer(),
+		"{scheme}":      urlScheme(r),
+	}
+
+	for k, v := range values {
+		if strings.Contains(format, k) {
+			format = strings.Replace(format, k, v, -1)
+		}
+	}
+
+	if strings.Contains(format, "{latency_human}") {
+		l := "..."
+		if latency > -1 {
+			l = latency.String()
+		}
+		format = strings.Replace(format, "{latency_human}", l, -1)
+	}
+
+	if strings.Contains(format, "{latency}") {
+		l := "..."
+		if latency > -1 {
+			l = strconv.FormatInt(latency.Nanoseconds(), 10)
+		}
+		format = strings.Replace(format, "{latency}", l, -1)
+	}
+
+	if strings.Contains(format, "{txbytes}") {
+		size := "..."
+		if v, ok := w.(internal.ResponseWriter); ok {
+			size = strconv.Itoa(v.Size())
+		}
+		format = strings.Replace(format, "{txbytes}", size, -1)
+	}
+
+	if strings.Contains(format, "{status}") {
+		status := "..."
+		if v, ok := w.(internal.ResponseWriter); ok {
+			status = strconv.Itoa(v.Status())
+		}
+		format = strings.Replace(format, "{status}", status, -1)
+	}
+
+	return format
+}
@@ -0,0 +1,205 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package requestid assigns an ID to every HTTP request, either accepting the one sent
+// by the client or a proxy, or generating a new one, and makes it available through the
+// request's context.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHeader is the default header used to read and send request IDs.
+	DefaultHeader = "X-Request-ID"
+	// DefaultMaxLength is the default maximum length of incoming request IDs.
+	DefaultMaxLength = 128
+	// DefaultCharset holds the characters allowed by default in incoming request IDs.
+	DefaultCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_.:"
+
+	traceparent = "Traceparent"
+)
+
+// handler is a private struct which contains the handler's configurable options.
+type handler struct {
+	header      string
+	maxLength   int
+	charset     string
+	traceparent bool
+	generate    func() string
+}
+
+// Option implements http://commandcenter.blogspot.com/2014/01/self-referential-functions-and-design.html
+type Option func(*handler)
+
+// WithHeader configures the header used to read incoming request IDs and to send them back
+// in the response.
+func WithHeader(name string) Option {
+	return func(h *handler) {
+		h.header = name
+	}
+}
+
+// WithMaxLength configures the maximum length of incoming request IDs. Longer IDs are
+// discarded and a new one is generated.
+func WithMaxLength(n int) Option {
+	return func(h *handler) {
+		h.maxLength = n
+	}
+}
+
+// WithCharset configures the characters allowed in incoming request IDs. IDs containing
+// any other character are discarded and a new one is generated.
+func WithCharset(chars string) Option {
+	return func(h *handler) {
+		h.charset = chars
+	}
+}
+
+// WithTraceparent configures whether the trace ID of a W3C traceparent header is used as
+// request ID, when the request does not carry one already. Enabled by default.
+func WithTraceparent(enabled bool) Option {
+	return func(h *handler) {
+		h.traceparent = enabled
+	}
+}
+
+// WithGenerator configures the function used to generate new request IDs. By default,
+// UUIDv7 identifiers are generated.
+func WithGenerator(fn func() string) Option {
+	return func(h *handler) {
+		h.generate = fn
+	}
+}
+
+// Handler makes sure every request has an ID. It accepts the ID sent in the configured
+// header, or the trace ID sent in the traceparent header, as long as they are within the
+// configured length and charset limits. Otherwise, a new ID is generated. The ID is stored
+// in the request's context, see FromContext, and sent back in the response header.
+func Handler(h http.Handler, opts ...Option) http.Handler {
+	// Sets default options
+	rh := &handler{
+		header:      DefaultHeader,
+		maxLength:   DefaultMaxLength,
+		charset:     DefaultCharset,
+		traceparent: true,
+		generate:    NewUUIDv7,
+	}
+
+	for _, opt := range opts {
+		opt(rh)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := rh.requestID(r)
+
+		w.Header().Set(rh.header, id)
+		h.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// requestID returns the ID of the request, generating a new one if the request does not
+// carry a valid ID.
+func (h *handler) requestID(r *http.Request) string {
+	if id := r.Header.Get(h.header); h.valid(id) {
+		return id
+	}
+
+	if h.traceparent {
+		if id := traceID(r.Header.Get(traceparent)); id != "" {
+			return id
+		}
+	}
+
+	return h.generate()
+}
+
+// valid returns whether the given request ID is within the configured length and charset limits.
+func (h *handler) valid(id string) bool {
+	if id == "" || len(id) > h.maxLength {
+		return false
+	}
+
+	for _, c := range id {
+		if !strings.ContainsRune(h.charset, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// traceID extracts the trace ID from a W3C traceparent header value, as described in
+// https://www.w3.org/TR/trace-context/#traceparent-header. It returns an empty string if
+// the value is invalid.
+func traceID(value string) string {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return ""
+	}
+
+	id := parts[1]
+	if len(id) != 32 || !isLowerHex(id) || id == strings.Repeat("0", 32) {
+		return ""
+	}
+	return id
+}
+
+// isLowerHex returns whether s only contains lowercase hexadecimal digits.
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// NewUUIDv7 returns a new time-ordered UUID, as described in RFC 9562 section 5.7.
+func NewUUIDv7() string {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return ""
+	}
+
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixMilli()))
+	copy(b[:6], ms[2:])
+
+	b[6] = b[6]&0x0f | 0x70 // version 7
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+
+	return string(buf[:])
+}
+
+// requestIDKey is the key used to store the request ID in the request's context.
+type requestIDKey struct{}
+
+// NewContext returns a new context carrying the given request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// FromContext extracts the request ID from the given context.
+func FromContext(ctx context.Context) (id string, ok bool) {
+	id, ok = ctx.Value(requestIDKey{}).(string)
+	return
+}
@@ -0,0 +1,72 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+var uuidv7 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		opts     []Option
+		response string
+		expected string
+	}{
+		{"generated", nil, nil, DefaultHeader, ""},
+		{"incoming", http.Header{"X-Request-Id": {"abc-123"}}, nil, DefaultHeader, "abc-123"},
+		{"too long", http.Header{"X-Request-Id": {strings.Repeat("a", 10)}}, []Option{WithMaxLength(5)}, DefaultHeader, ""},
+		{"invalid charset", http.Header{"X-Request-Id": {"abc 123\n"}}, nil, DefaultHeader, ""},
+		{"custom charset", http.Header{"X-Request-Id": {"abc-123"}}, []Option{WithCharset("abc123")}, DefaultHeader, ""},
+		{"custom header", http.Header{"Request-Id": {"abc"}}, []Option{WithHeader("Request-ID")}, "Request-ID", "abc"},
+		{"traceparent", http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}, nil, DefaultHeader, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"invalid traceparent", http.Header{"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"}}, nil, DefaultHeader, ""},
+		{"traceparent disabled", http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}, []Option{WithTraceparent(false)}, DefaultHeader, ""},
+		{"custom generator", nil, []Option{WithGenerator(func() string { return "fixed" })}, DefaultHeader, "fixed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctxID string
+			requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				id, ok := FromContext(r.Context())
+				assert.Equals(t, true, ok)
+				ctxID = id
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			rec := httptest.NewRecorder()
+
+			Handler(requestHandler, tt.opts...).ServeHTTP(rec, req)
+
+			assert.Equals(t, ctxID, rec.Header().Get(tt.response))
+
+			if tt.expected == "" {
+				assert.Cond(t, uuidv7.MatchString(ctxID), "expected a generated UUIDv7, got %q", ctxID)
+				return
+			}
+			assert.Equals(t, tt.expected, ctxID)
+		})
+	}
+}
+
+func TestNewUUIDv7(t *testing.T) {
+	a, b := NewUUIDv7(), NewUUIDv7()
+	assert.Cond(t, uuidv7.MatchString(a), "invalid UUIDv7: %q", a)
+	assert.Cond(t, a != b, "UUIDs should be unique")
+	assert.Cond(t, a[:8] <= b[:8], "UUIDs should be time-ordered")
+}
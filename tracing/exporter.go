@@ -0,0 +1,50 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tracing
+
+import (
+	"context"
+	"sync"
+)
+
+// Exporter sends finished spans to a tracing backend, for instance through an adapter
+// to an OpenTelemetry exporter. ExportSpans is called once per request, from the request's
+// goroutine, so implementations should batch or export asynchronously.
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []*Span) error
+}
+
+// InMemoryExporter keeps exported spans in memory. It is meant for testing.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// NewInMemoryExporter returns a new InMemoryExporter.
+func NewInMemoryExporter() *InMemoryExporter {
+	return new(InMemoryExporter)
+}
+
+// ExportSpans stores the given spans.
+func (e *InMemoryExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// Spans returns the spans exported so far.
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset discards the spans exported so far.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
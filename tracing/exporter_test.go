@@ -0,0 +1,24 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+func TestInMemoryExporter(t *testing.T) {
+	e := NewInMemoryExporter()
+	a, b := &Span{Name: "a"}, &Span{Name: "b"}
+
+	assert.Ok(t, e.ExportSpans(context.Background(), []*Span{a}))
+	assert.Ok(t, e.ExportSpans(context.Background(), []*Span{b}))
+	assert.Equals(t, []*Span{a, b}, e.Spans())
+
+	e.Reset()
+	assert.Equals(t, 0, len(e.Spans()))
+}
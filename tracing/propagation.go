@@ -0,0 +1,103 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context headers.
+const (
+	TraceparentHeader = "Traceparent"
+	TracestateHeader  = "Tracestate"
+)
+
+// Extract returns the span context propagated in the traceparent and tracestate headers,
+// as described in https://www.w3.org/TR/trace-context/. It returns false if traceparent is
+// missing or invalid, in which case tracestate is ignored as well.
+func Extract(headers http.Header) (SpanContext, bool) {
+	sc, ok := parseTraceparent(headers.Get(TraceparentHeader))
+	if !ok {
+		return SpanContext{}, false
+	}
+
+	var states []string
+	for _, v := range headers.Values(TracestateHeader) {
+		if v = strings.TrimSpace(v); v != "" {
+			states = append(states, v)
+		}
+	}
+	sc.TraceState = strings.Join(states, ",")
+	sc.Remote = true
+
+	return sc, true
+}
+
+// Inject sets the traceparent and tracestate headers propagating the span carried by the
+// given context, if any, for instance on outgoing requests to other services.
+func Inject(ctx context.Context, headers http.Header) {
+	s, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+
+	headers.Set(TraceparentHeader, formatTraceparent(s.SpanContext))
+	if s.TraceState != "" {
+		headers.Set(TracestateHeader, s.TraceState)
+	} else {
+		headers.Del(TracestateHeader)
+	}
+}
+
+// parseTraceparent parses a traceparent header value.
+func parseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return sc, false
+	}
+
+	version, ok := decodeHex(parts[0], 1)
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return sc, false
+	}
+
+	traceID, ok := decodeHex(parts[1], len(sc.TraceID))
+	if !ok {
+		return sc, false
+	}
+	spanID, ok := decodeHex(parts[2], len(sc.SpanID))
+	if !ok {
+		return sc, false
+	}
+	flags, ok := decodeHex(parts[3], 1)
+	if !ok {
+		return sc, false
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.TraceFlags = flags[0]
+
+	return sc, sc.IsValid()
+}
+
+// formatTraceparent returns the traceparent header value of the given span context.
+func formatTraceparent(sc SpanContext) string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.TraceFlags})
+}
+
+// decodeHex decodes s, which must be made of n bytes encoded as lowercase hexadecimal.
+func decodeHex(s string, n int) ([]byte, bool) {
+	if len(s) != 2*n || strings.ToLower(s) != s {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
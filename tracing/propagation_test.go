@@ -0,0 +1,70 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+const (
+	traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	traceIDHex  = "4bf92f3577b34da6a3ce929d0e0e4736"
+	spanIDHex   = "00f067aa0ba902b7"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     http.Header
+		valid      bool
+		sampled    bool
+		tracestate string
+	}{
+		{"valid", http.Header{"Traceparent": {traceparent}}, true, true, ""},
+		{"not sampled", http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"}}, true, false, ""},
+		{"tracestate", http.Header{"Traceparent": {traceparent}, "Tracestate": {"congo=t61rcWkgMzE", " rojo=00f067aa0ba902b7"}}, true, true, "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7"},
+		{"future version", http.Header{"Traceparent": {"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"}}, true, true, ""},
+		{"missing", http.Header{"Tracestate": {"congo=t61rcWkgMzE"}}, false, false, ""},
+		{"invalid version", http.Header{"Traceparent": {"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}, false, false, ""},
+		{"extra fields in version 00", http.Header{"Traceparent": {traceparent + "-extra"}}, false, false, ""},
+		{"zero trace ID", http.Header{"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"}}, false, false, ""},
+		{"zero span ID", http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"}}, false, false, ""},
+		{"uppercase", http.Header{"Traceparent": {"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"}}, false, false, ""},
+		{"short", http.Header{"Traceparent": {"00-4bf92f35-00f067aa0ba902b7-01"}}, false, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := Extract(tt.header)
+			assert.Equals(t, tt.valid, ok)
+			if !tt.valid {
+				return
+			}
+
+			assert.Equals(t, traceIDHex, sc.TraceID.String())
+			assert.Equals(t, spanIDHex, sc.SpanID.String())
+			assert.Equals(t, tt.sampled, sc.IsSampled())
+			assert.Equals(t, tt.tracestate, sc.TraceState)
+			assert.Equals(t, true, sc.Remote)
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	sc, ok := Extract(http.Header{"Traceparent": {traceparent}, "Tracestate": {"congo=t61rcWkgMzE"}})
+	assert.Equals(t, true, ok)
+
+	headers := make(http.Header)
+	Inject(context.Background(), headers)
+	assert.Equals(t, 0, len(headers))
+
+	Inject(NewContext(context.Background(), &Span{SpanContext: sc}), headers)
+	assert.Equals(t, traceparent, headers.Get(TraceparentHeader))
+	assert.Equals(t, "congo=t61rcWkgMzE", headers.Get(TracestateHeader))
+}
@@ -0,0 +1,157 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace, as described in https://www.w3.org/TR/trace-context/#trace-id.
+type TraceID [16]byte
+
+// IsValid returns whether the ID is not all zeros.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// String returns the ID as lowercase hexadecimal.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies a span, as described in https://www.w3.org/TR/trace-context/#parent-id.
+type SpanID [8]byte
+
+// IsValid returns whether the ID is not all zeros.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// String returns the ID as lowercase hexadecimal.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// FlagsSampled is the trace flag signaling that the caller may have recorded the trace.
+const FlagsSampled byte = 0x01
+
+// SpanContext holds the identifiers of a span propagated across services.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	TraceFlags byte
+	// TraceState holds vendor specific trace information, see
+	// https://www.w3.org/TR/trace-context/#tracestate-header.
+	TraceState string
+	// Remote is true if the span context was received from another service.
+	Remote bool
+}
+
+// IsValid returns whether both the trace and span IDs are valid.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled returns whether the sampled flag is set.
+func (sc SpanContext) IsSampled() bool {
+	return sc.TraceFlags&FlagsSampled != 0
+}
+
+// SpanKind describes the relationship of a span with the other spans of the trace.
+type SpanKind int
+
+// SpanKindServer is the kind of the spans covering the server side of a request. Its
+// value matches OpenTelemetry's.
+const SpanKindServer SpanKind = 2
+
+// StatusCode is the status of a span's operation.
+type StatusCode int
+
+const (
+	// StatusUnset is the default status.
+	StatusUnset StatusCode = iota
+	// StatusError signals the operation failed.
+	StatusError
+	// StatusOK signals the operation was explicitly marked as successful.
+	StatusOK
+)
+
+// Attribute is a key-value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span represents the handling of a request. Handlers can add attributes to the span of
+// the request they serve, see FromContext. Its fields must not be modified directly, and
+// are only safe to read once the span has ended, as exporters do.
+type Span struct {
+	Name string
+	Kind SpanKind
+	SpanContext
+	// Parent is the span context of the caller, invalid for root spans.
+	Parent     SpanContext
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	Status     StatusCode
+
+	mu sync.Mutex
+}
+
+// SetAttributes adds attributes to the span, replacing the values of existing keys.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, attr := range attrs {
+		s.setAttribute(attr)
+	}
+}
+
+// Attribute returns the value of the attribute with the given key, nil if it is not set.
+func (s *Span) Attribute(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+// setAttribute adds or replaces an attribute. s.mu must be held.
+func (s *Span) setAttribute(attr Attribute) {
+	for i, a := range s.Attributes {
+		if a.Key == attr.Key {
+			s.Attributes[i].Value = attr.Value
+			return
+		}
+	}
+	s.Attributes = append(s.Attributes, attr)
+}
+
+// newTraceID returns a random trace ID.
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// newSpanID returns a random span ID.
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
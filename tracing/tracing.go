@@ -0,0 +1,187 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package tracing implements distributed tracing of HTTP requests. It follows the W3C
+// Trace Context propagation format and OpenTelemetry's semantic conventions for HTTP
+// servers, and exports spans through a pluggable Exporter.
+package tracing
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/c4milo/handlers/clientip"
+	"github.com/c4milo/handlers/internal"
+)
+
+// handler is a private struct which contains the handler's configurable options.
+type handler struct {
+	exporter Exporter
+	route    func(*http.Request) string
+}
+
+// Option implements http://commandcenter.blogspot.com/2014/01/self-referential-functions-and-design.html
+type Option func(*handler)
+
+// WithExporter configures the exporter finished spans are sent to. Without it, spans are
+// created and propagated but not exported.
+func WithExporter(e Exporter) Option {
+	return func(h *handler) {
+		h.exporter = e
+	}
+}
+
+// WithRoute configures the function returning the route matched by the request, such as
+// /users/{id}, used to name spans and set their http.route attribute. It is called once
+// the request has been served, with the request passed to the wrapped handler, so that
+// it can return the route matched by a router. Without it, spans are named after the
+// request method only, since paths have unbounded cardinality.
+func WithRoute(fn func(*http.Request) string) Option {
+	return func(h *handler) {
+		h.route = fn
+	}
+}
+
+// Handler creates a server span for every request, continuing the trace propagated by the
+// caller through the traceparent and tracestate headers, if any, or starting a new one.
+// The span is stored in the request's context, see FromContext, and exported once the
+// request has been served if it is sampled: new traces always are, and propagated ones
+// if the caller's sampled flag is set.
+//
+// Spans get the following attributes: http.request.method, url.path, url.scheme,
+// server.address, network.protocol.version, user_agent.original, client.address,
+// http.route and http.response.status_code. Their status is set to error for 5xx
+// responses and if the handler panics.
+func Handler(h http.Handler, opts ...Option) http.Handler {
+	th := new(handler)
+	for _, opt := range opts {
+		opt(th)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := th.start(r)
+		res := internal.NewResponseWriter(w)
+		r = r.WithContext(NewContext(r.Context(), span))
+
+		defer func() {
+			if err := recover(); err != nil {
+				th.end(r, span, res, true)
+				panic(err)
+			}
+		}()
+
+		h.ServeHTTP(res, r)
+		th.end(r, span, res, false)
+	})
+}
+
+// start returns a new server span for the request.
+func (h *handler) start(r *http.Request) *Span {
+	s := &Span{
+		Kind:  SpanKindServer,
+		Start: time.Now(),
+		SpanContext: SpanContext{
+			TraceID:    newTraceID(),
+			SpanID:     newSpanID(),
+			TraceFlags: FlagsSampled,
+		},
+	}
+
+	if parent, ok := Extract(r.Header); ok {
+		s.Parent = parent
+		s.TraceID = parent.TraceID
+		s.TraceFlags = parent.TraceFlags
+		s.TraceState = parent.TraceState
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	s.Name = r.Method
+	s.Attributes = []Attribute{
+		{"http.request.method", r.Method},
+		{"url.path", r.URL.Path},
+		{"url.scheme", scheme},
+		{"server.address", r.Host},
+		{"network.protocol.version", strconv.Itoa(r.ProtoMajor) + "." + strconv.Itoa(r.ProtoMinor)},
+	}
+	if ua := r.UserAgent(); ua != "" {
+		s.Attributes = append(s.Attributes, Attribute{"user_agent.original", ua})
+	}
+	if ip := clientAddress(r); ip != "" {
+		s.Attributes = append(s.Attributes, Attribute{"client.address", ip})
+	}
+
+	return s
+}
+
+// end ends the span, naming it after the route matched by the request and setting its
+// status, and exports it if it is sampled.
+func (h *handler) end(r *http.Request, s *Span, res internal.ResponseWriter, panicked bool) {
+	status := res.Status()
+	if status == 0 && !panicked {
+		// Nothing was written, the server replies with 200 OK.
+		status = http.StatusOK
+	}
+
+	var route string
+	if h.route != nil {
+		route = h.route(r)
+	}
+
+	s.mu.Lock()
+	s.End = time.Now()
+	if route != "" {
+		s.Name = r.Method + " " + route
+		s.setAttribute(Attribute{"http.route", route})
+	}
+	if status != 0 {
+		s.setAttribute(Attribute{"http.response.status_code", status})
+	}
+	switch {
+	case panicked:
+		s.Status = StatusError
+		s.setAttribute(Attribute{"error.type", "panic"})
+	case status >= 500:
+		s.Status = StatusError
+		s.setAttribute(Attribute{"error.type", strconv.Itoa(status)})
+	}
+	s.mu.Unlock()
+
+	if h.exporter != nil && s.IsSampled() {
+		h.exporter.ExportSpans(r.Context(), []*Span{s})
+	}
+}
+
+// clientAddress returns the client IP resolved by clientip.Handler, or the remote address
+// of the connection.
+func clientAddress(r *http.Request) string {
+	if ip, ok := clientip.FromContext(r.Context()); ok {
+		return ip.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// spanKey is the key used to store the span in the request's context.
+type spanKey struct{}
+
+// NewContext returns a new context carrying the given span.
+func NewContext(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// FromContext extracts the span from the given context.
+func FromContext(ctx context.Context) (s *Span, ok bool) {
+	s, ok = ctx.Value(spanKey{}).(*Span)
+	return
+}
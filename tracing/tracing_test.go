@@ -0,0 +1,146 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hooklift/assert"
+)
+
+func TestHandler(t *testing.T) {
+	requestHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span, ok := FromContext(r.Context())
+		assert.Equals(t, true, ok)
+		span.SetAttributes(Attribute{"app.user_id", 42})
+
+		if r.URL.Path == "/users/error" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})
+
+	route := func(r *http.Request) string {
+		return "/users/{id}"
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		status int
+		error  bool
+	}{
+		{"new trace", "/users/1", nil, http.StatusOK, false},
+		{"propagated trace", "/users/1", http.Header{"Traceparent": {traceparent}, "Tracestate": {"congo=t61rcWkgMzE"}}, http.StatusOK, false},
+		{"server error", "/users/error", nil, http.StatusBadGateway, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := NewInMemoryExporter()
+			traced := Handler(requestHandler, WithExporter(exporter), WithRoute(route))
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("User-Agent", "test-agent/1.0")
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			traced.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := exporter.Spans()
+			assert.Equals(t, 1, len(spans))
+			span := spans[0]
+
+			assert.Equals(t, "GET /users/{id}", span.Name)
+			assert.Equals(t, SpanKindServer, span.Kind)
+			assert.Cond(t, span.IsValid(), "span context should be valid")
+			assert.Cond(t, !span.End.Before(span.Start), "span should end after it starts")
+
+			if tt.header != nil {
+				assert.Equals(t, traceIDHex, span.TraceID.String())
+				assert.Equals(t, spanIDHex, span.Parent.SpanID.String())
+				assert.Cond(t, span.SpanID.String() != spanIDHex, "a new span ID should be generated")
+				assert.Equals(t, "congo=t61rcWkgMzE", span.TraceState)
+			} else {
+				assert.Equals(t, false, span.Parent.IsValid())
+			}
+
+			assert.Equals(t, "GET", span.Attribute("http.request.method"))
+			assert.Equals(t, tt.path, span.Attribute("url.path"))
+			assert.Equals(t, "http", span.Attribute("url.scheme"))
+			assert.Equals(t, "example.com", span.Attribute("server.address"))
+			assert.Equals(t, "1.1", span.Attribute("network.protocol.version"))
+			assert.Equals(t, "test-agent/1.0", span.Attribute("user_agent.original"))
+			assert.Equals(t, "192.0.2.1", span.Attribute("client.address"))
+			assert.Equals(t, "/users/{id}", span.Attribute("http.route"))
+			assert.Equals(t, tt.status, span.Attribute("http.response.status_code"))
+			assert.Equals(t, 42, span.Attribute("app.user_id"))
+
+			if tt.error {
+				assert.Equals(t, StatusError, span.Status)
+				assert.Equals(t, "502", span.Attribute("error.type"))
+			} else {
+				assert.Equals(t, StatusUnset, span.Status)
+			}
+		})
+	}
+}
+
+func TestHandlerNotSampled(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	traced := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), WithExporter(exporter))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	traced.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equals(t, 0, len(exporter.Spans()))
+}
+
+func TestHandlerPanic(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	traced := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), WithExporter(exporter))
+
+	func() {
+		defer func() {
+			assert.Equals(t, "boom", recover())
+		}()
+		traced.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+
+	spans := exporter.Spans()
+	assert.Equals(t, 1, len(spans))
+	assert.Equals(t, StatusError, spans[0].Status)
+	assert.Equals(t, "panic", spans[0].Attribute("error.type"))
+	assert.Equals(t, nil, spans[0].Attribute("http.response.status_code"))
+}
+
+// routeKey is the context key of the route matched by the router in
+// TestHandlerRouteAfterDispatch.
+type routeKey struct{}
+
+func TestHandlerRouteAfterDispatch(t *testing.T) {
+	router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*r.Context().Value(routeKey{}).(*string) = "/users/{id}"
+	})
+
+	exporter := NewInMemoryExporter()
+	traced := Handler(router, WithExporter(exporter), WithRoute(func(r *http.Request) string {
+		return *r.Context().Value(routeKey{}).(*string)
+	}))
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	traced.ServeHTTP(httptest.NewRecorder(), req.WithContext(context.WithValue(req.Context(), routeKey{}, new(string))))
+
+	spans := exporter.Spans()
+	assert.Equals(t, 1, len(spans))
+	assert.Equals(t, "GET /users/{id}", spans[0].Name)
+	assert.Equals(t, "/users/{id}", spans[0].Attribute("http.route"))
+}